@@ -0,0 +1,169 @@
+// Command hashring-proxy is a reverse proxy sharding HTTP requests to upstreams by consistent hashing.
+//
+// Usage:
+//
+//	hashring-proxy -upstreams host:port,... [-listen addr] [-admin addr] [-key kind:name] [flags]
+//
+// The routing key is read from a header (header:X-Shard), a query parameter (query:tenant)
+// or a path segment (path:0). Upstreams failing their health checks are skipped, and unreachable
+// upstreams fail over to the next replica of the key. The admin address serves the upstream list,
+// and adds or removes upstreams with POST and DELETE requests carrying a node parameter.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mugli/hashring"
+	"github.com/mugli/hashring/hashhttp"
+	"github.com/mugli/hashring/health"
+)
+
+type server struct {
+	listen   string
+	admin    string
+	holder   *hashring.Holder
+	proxy    *hashhttp.Proxy
+	monitor  *health.Monitor // monitor is nil when health checks are disabled
+	shutdown time.Duration
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "hashring-proxy: %s\n", err)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(ctx context.Context, args []string, stderr io.Writer) error {
+	s, err := newServer(args, stderr)
+	if err != nil {
+		return err
+	}
+
+	if s.monitor != nil {
+		go s.monitor.Run(ctx)
+	}
+	servers := []*http.Server{{Addr: s.listen, Handler: s.proxy}}
+	if s.admin != "" {
+		servers = append(servers, &http.Server{Addr: s.admin, Handler: s.proxy.AdminHandler()})
+	}
+
+	errs := make(chan error, len(servers))
+	for _, srv := range servers {
+		srv := srv
+		go func() { errs <- srv.ListenAndServe() }()
+	}
+
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdown)
+	defer cancel()
+	for _, srv := range servers {
+		_ = srv.Shutdown(shutdownCtx)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func newServer(args []string, stderr io.Writer) (*server, error) {
+	flags := flag.NewFlagSet("hashring-proxy", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	listen := flags.String("listen", ":8080", "address serving the proxied requests")
+	admin := flags.String("admin", "", "address serving the admin endpoint, disabled if empty")
+	upstreams := flags.String("upstreams", "", "comma separated host:port of the upstreams")
+	hashName := flags.String("hash", "md5", "hash function: "+strings.Join(hashring.HashNames(), ", "))
+	key := flags.String("key", "header:X-Shard", "routing key: header:<name>, query:<name> or path:<index>")
+	replicas := flags.Int("replicas", 2, "number of upstreams tried per request")
+	loadFactor := flags.Float64("load-factor", 0, "bound the load of upstreams to this factor of the average, disabled if <= 1")
+	healthInterval := flags.Duration("health-interval", 5*time.Second, "interval between health checks, disabled if 0")
+	healthPath := flags.String("health-path", "/", "path of the health checks")
+	shutdown := flags.Duration("shutdown-timeout", 10*time.Second, "time given to in-flight requests on shutdown")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	keyFunc, err := parseKey(*key)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]hashring.Node, 0)
+	for _, upstream := range strings.Split(*upstreams, ",") {
+		if upstream = strings.TrimSpace(upstream); upstream != "" {
+			nodes = append(nodes, hashring.StringNode(upstream))
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("missing -upstreams")
+	}
+	ring, err := hashring.NewWithHashName(nodes, *hashName)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &server{
+		listen:   *listen,
+		admin:    *admin,
+		holder:   hashring.NewHolder(ring),
+		shutdown: *shutdown,
+	}
+	s.proxy = hashhttp.NewProxy(s.holder, hashhttp.ProxyOptions{
+		Key:        keyFunc,
+		Replicas:   *replicas,
+		LoadFactor: *loadFactor,
+		NewNode:    func(name string) hashring.Node { return hashring.StringNode(name) },
+	})
+	if *healthInterval > 0 {
+		checker := &health.HTTPChecker{URL: func(n hashring.Node) string { return "http://" + n.String() + *healthPath }}
+		s.monitor = health.NewMonitor(s.holder, checker, health.Config{
+			Interval: *healthInterval,
+			OnChange: func(n hashring.Node, up bool, err error) {
+				if up {
+					fmt.Fprintf(stderr, "upstream %s is up\n", n)
+				} else {
+					fmt.Fprintf(stderr, "upstream %s is down: %s\n", n, err)
+				}
+			},
+		})
+	}
+	return s, nil
+}
+
+func parseKey(key string) (hashhttp.KeyFunc, error) {
+	kind, name, ok := strings.Cut(key, ":")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("invalid -key %q", key)
+	}
+	switch kind {
+	case "header":
+		return hashhttp.HeaderKey(name), nil
+	case "query":
+		return hashhttp.QueryKey(name), nil
+	case "path":
+		index, err := strconv.Atoi(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -key %q: %w", key, err)
+		}
+		return hashhttp.PathSegmentKey(index), nil
+	default:
+		return nil, fmt.Errorf("invalid -key %q: unknown kind %q", key, kind)
+	}
+}
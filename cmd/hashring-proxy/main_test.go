@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://proxy/users/42?tenant=acme", nil)
+	req.Header.Set("X-Shard", "s1")
+
+	for spec, expected := range map[string]string{
+		"header:X-Shard": "s1",
+		"query:tenant":   "acme",
+		"path:1":         "42",
+	} {
+		keyFunc, err := parseKey(spec)
+		if assert.NoError(t, err, spec) {
+			key, err := keyFunc(req)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, key)
+		}
+	}
+
+	for _, spec := range []string{"header", "header:", "path:x", "cookie:id"} {
+		_, err := parseKey(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello "+r.URL.Path)
+	}))
+	defer upstream.Close()
+	addr := upstream.Listener.Addr().String()
+
+	var stderr bytes.Buffer
+	s, err := newServer([]string{"-upstreams", addr, "-key", "path:0", "-health-interval", "0"}, &stderr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Nil(t, s.monitor)
+
+	rec := httptest.NewRecorder()
+	s.proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://proxy/key", nil))
+	assert.Equal(t, "hello /key", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	s.proxy.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, strings.Contains(rec.Body.String(), addr))
+
+	_, err = newServer([]string{}, &stderr)
+	assert.Error(t, err)
+	_, err = newServer([]string{"-upstreams", addr, "-hash", "crc"}, &stderr)
+	assert.Error(t, err)
+}
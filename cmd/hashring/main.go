@@ -0,0 +1,305 @@
+// Command hashring inspects and simulates consistent hash rings built from a list of nodes.
+//
+// Usage:
+//
+//	hashring [-nodes file] [-hash name] [-vnodes n] [-replicas n] <command> [arguments]
+//
+// The node list has one node per line, empty lines and lines starting with # are ignored.
+// It's read from stdin unless -nodes is given. -vnodes places several tokens per node on the ring,
+// stats shows how evenly the keyspace is spread for a given number. Commands are:
+//
+//	lookup <key>...                      print the primary and replicas of keys
+//	stats                                print the share of the hash space owned by each node
+//	diff [-add node]... [-remove node]... print the hash ranges changing owner
+//	simulate -keys file [-top n] [-add node]... [-remove node]...
+//	                                     replay newline-delimited keys against the ring
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mugli/hashring"
+)
+
+// stringList is a flag.Value collecting repeated flags.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+const usage = `usage: hashring [-nodes file] [-hash name] [-vnodes n] [-replicas n] <command> [arguments]
+
+commands:
+  lookup <key>...                         print the primary and replicas of keys
+  stats                                   print the share of the hash space owned by each node
+  diff [-add node]... [-remove node]...   print the hash ranges changing owner
+  simulate -keys file [-top n] [-add node]... [-remove node]...
+                                          replay newline-delimited keys against the ring
+
+flags:
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "hashring: %s\n", err)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("hashring", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	nodesFile := flags.String("nodes", "-", "file with one node per line, - for stdin")
+	hashName := flags.String("hash", "md5", "hash function: "+strings.Join(hashring.HashNames(), ", "))
+	virtualNodes := flags.Int("vnodes", 1, "number of virtual nodes (tokens) per node, compare stats to choose it")
+	replicas := flags.Int("replicas", 1, "number of replicas per key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing command")
+	}
+	if *virtualNodes < 1 {
+		return errors.New("-vnodes must be at least 1")
+	}
+
+	nodes, err := readNodes(*nodesFile, stdin)
+	if err != nil {
+		return err
+	}
+	ring, err := hashring.NewWithHashName(nodes, *hashName)
+	if err != nil {
+		return err
+	}
+	ring = ring.WithVirtualNodes(*virtualNodes)
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "lookup":
+		return lookup(ring, *replicas, commandArgs, stdout)
+	case "stats":
+		return stats(ring, *replicas, stdout)
+	case "diff":
+		return diff(ring, *replicas, commandArgs, stdout, stderr)
+	case "simulate":
+		return simulate(ring, *nodesFile, commandArgs, stdin, stdout, stderr)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func readNodes(file string, stdin io.Reader) ([]hashring.Node, error) {
+	r := stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	nodes := make([]hashring.Node, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		nodes = append(nodes, hashring.StringNode(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading nodes: %w", err)
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("node list is empty")
+	}
+	return nodes, nil
+}
+
+func lookup(ring *hashring.HashRing, replicas int, keys []string, stdout io.Writer) error {
+	if len(keys) == 0 {
+		return errors.New("lookup: missing key")
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tPRIMARY\tREPLICAS")
+	for _, key := range keys {
+		nodes, ok := ring.GetNodesForReplicas(key, replicas)
+		if !ok {
+			return fmt.Errorf("lookup: ring has less than %d nodes", replicas)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", key, nodes[0], joinNodes(nodes[1:]))
+	}
+	return w.Flush()
+}
+
+func stats(ring *hashring.HashRing, replicas int, stdout io.Writer) error {
+	ownership := ring.Ownership(replicas)
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tPRIMARY\tREPLICA")
+	for _, node := range ownership.Nodes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", node.Node, percent(node.Primary), percent(node.Replica))
+	}
+	fmt.Fprintf(w, "min\t%s\t%s\n", percent(ownership.Primary.Min), percent(ownership.Replica.Min))
+	fmt.Fprintf(w, "max\t%s\t%s\n", percent(ownership.Primary.Max), percent(ownership.Replica.Max))
+	fmt.Fprintf(w, "mean\t%s\t%s\n", percent(ownership.Primary.Mean), percent(ownership.Replica.Mean))
+	fmt.Fprintf(w, "stddev\t%s\t%s\n", percent(ownership.Primary.StdDev), percent(ownership.Replica.StdDev))
+	fmt.Fprintf(w, "max/mean\t%.3f\t%.3f\n", ownership.Primary.MaxMeanRatio, ownership.Replica.MaxMeanRatio)
+	return w.Flush()
+}
+
+// changeFlags registers the -add and -remove flags shared by diff and simulate.
+func changeFlags(flags *flag.FlagSet) (add, remove *stringList) {
+	add, remove = &stringList{}, &stringList{}
+	flags.Var(add, "add", "node to add, can be repeated")
+	flags.Var(remove, "remove", "node to remove, can be repeated")
+	return add, remove
+}
+
+func applyChanges(ring *hashring.HashRing, add, remove []string) *hashring.HashRing {
+	for _, name := range remove {
+		ring = ring.RemoveNode(hashring.StringNode(name))
+	}
+	for _, name := range add {
+		ring = ring.AddNode(hashring.StringNode(name))
+	}
+	return ring
+}
+
+func diff(ring *hashring.HashRing, replicas int, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	add, remove := changeFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	changes := hashring.DiffReplicas(ring, applyChanges(ring, *add, *remove), replicas)
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tEND\tFROM\tTO\tKEYSPACE")
+	moved := 0.0
+	for _, change := range changes {
+		moved += change.Fraction
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			position(change.Start), position(change.End), joinNodes(change.FromReplicas), joinNodes(change.ToReplicas), percent(change.Fraction))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(stdout, "\n%d ranges, %s of the keyspace moved\n", len(changes), percent(moved))
+	return err
+}
+
+func simulate(ring *hashring.HashRing, nodesFile string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	keysFile := flags.String("keys", "", "file with one key per line, - for stdin")
+	top := flags.Int("top", 3, "number of hottest keys to print per node")
+	add, remove := changeFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader
+	switch *keysFile {
+	case "":
+		return errors.New("simulate: missing -keys")
+	case "-":
+		if nodesFile == "-" {
+			return errors.New("simulate: nodes and keys can't both be read from stdin")
+		}
+		r = stdin
+	default:
+		f, err := os.Open(*keysFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	opts := hashring.SimulationOptions{HotKeys: *top}
+	if len(*add) > 0 || len(*remove) > 0 {
+		opts.Compare = applyChanges(ring, *add, *remove)
+	}
+	simulation, err := hashring.Simulate(ring, hashring.NewLineKeySource(r), opts)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tREQUESTS\tSHARE\tKEYS\tMOVED\tHOT KEYS")
+	for _, load := range simulation.Nodes {
+		hotKeys := make([]string, 0, len(load.HotKeys))
+		for _, hotKey := range load.HotKeys {
+			hotKeys = append(hotKeys, fmt.Sprintf("%s (%d)", hotKey.Key, hotKey.Count))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%d\t%s\n", load.Node, load.Count, percent(ratio(load.Count, simulation.Keys)),
+			load.UniqueKeys, load.Moved, strings.Join(hotKeys, ", "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "\n%d requests, %d distinct keys\n", simulation.Keys, simulation.UniqueKeys)
+	if opts.Compare != nil {
+		fmt.Fprintf(stdout, "%d distinct keys (%s) and %d requests (%s) would move\n",
+			simulation.MovedKeys, percent(ratio(simulation.MovedKeys, simulation.UniqueKeys)),
+			simulation.MovedRequests, percent(ratio(simulation.MovedRequests, simulation.Keys)))
+	}
+	return nil
+}
+
+func joinNodes(nodes []hashring.Node) string {
+	names := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		names = append(names, n.String())
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
+
+// position formats a key as its location on the ring, in [0, 1).
+func position(key hashring.HashKey) string {
+	if positioned, ok := key.(hashring.PositionedHashKey); ok {
+		return fmt.Sprintf("%.6f", positioned.Position())
+	}
+	return fmt.Sprintf("%v", key)
+}
+
+func percent(fraction float64) string {
+	return fmt.Sprintf("%.2f%%", fraction*100)
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testNodes = "a\n# comment\n\nb\nc\n"
+
+func runCommand(t *testing.T, stdin string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestLookup(t *testing.T) {
+	out, err := runCommand(t, testNodes, "-replicas", "2", "lookup", "test", "test3")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "KEY    PRIMARY  REPLICAS\ntest   a        c\ntest3  c        b\n", out)
+	}
+
+	_, err = runCommand(t, testNodes, "-replicas", "4", "lookup", "test")
+	assert.Error(t, err)
+}
+
+func TestStats(t *testing.T) {
+	out, err := runCommand(t, testNodes, "stats")
+	if assert.NoError(t, err) {
+		assert.Contains(t, out, "mean      33.33%   33.33%\n")
+	}
+}
+
+func TestStatsVirtualNodes(t *testing.T) {
+	out, err := runCommand(t, testNodes, "stats")
+	if assert.NoError(t, err) {
+		assert.Contains(t, out, "max/mean  1.182")
+	}
+
+	out, err = runCommand(t, testNodes, "-vnodes", "100", "stats")
+	if assert.NoError(t, err) {
+		assert.Contains(t, out, "max/mean  1.033")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	out, err := runCommand(t, testNodes, "diff", "-add", "d")
+	if assert.NoError(t, err) {
+		assert.Contains(t, out, "1 ranges, 23.38% of the keyspace moved")
+	}
+
+	out, err = runCommand(t, testNodes, "diff")
+	if assert.NoError(t, err) {
+		assert.Contains(t, out, "0 ranges, 0.00% of the keyspace moved")
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	dir := t.TempDir()
+	nodesFile := filepath.Join(dir, "nodes")
+	if !assert.NoError(t, os.WriteFile(nodesFile, []byte(testNodes), 0o600)) {
+		return
+	}
+
+	out, err := runCommand(t, "test\ntest\ntest1\naaaa\n", "-nodes", nodesFile, "simulate", "-keys", "-", "-add", "d")
+	if assert.NoError(t, err) {
+		assert.Contains(t, out, "a     2         50.00%  1     2      test (2)")
+		assert.Contains(t, out, "1 distinct keys (33.33%) and 2 requests (50.00%) would move")
+	}
+
+	_, err = runCommand(t, testNodes, "simulate", "-keys", "-")
+	assert.Error(t, err)
+}
+
+func TestErrors(t *testing.T) {
+	_, err := runCommand(t, testNodes)
+	assert.EqualError(t, err, "missing command")
+
+	_, err = runCommand(t, testNodes, "unknown")
+	assert.EqualError(t, err, `unknown command "unknown"`)
+
+	_, err = runCommand(t, testNodes, "-hash", "crc32", "stats")
+	assert.EqualError(t, err, `hash function "crc32" is not registered`)
+
+	_, err = runCommand(t, testNodes, "-vnodes", "0", "stats")
+	assert.EqualError(t, err, "-vnodes must be at least 1")
+
+	_, err = runCommand(t, "", "stats")
+	assert.EqualError(t, err, "node list is empty")
+}
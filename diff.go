@@ -0,0 +1,102 @@
+package hashring
+
+// RangeChange describes a Range of the hash ring whose owners differ between two rings.
+type RangeChange struct {
+	Range
+	From         Node    // From is the primary owner in the old ring, nil if the old ring is empty.
+	To           Node    // To is the primary owner in the new ring, nil if the new ring is empty.
+	FromReplicas []Node  // FromReplicas is the replica set in the old ring, only filled by DiffReplicas.
+	ToReplicas   []Node  // ToReplicas is the replica set in the new ring, only filled by DiffReplicas.
+	Fraction     float64 // Fraction is the portion of the keyspace covered by the Range.
+}
+
+// Diff returns the ranges of the hash space whose primary owner is different in new than in old.
+// Adjacent ranges moving between the same nodes are merged together.
+// Both rings must be created with the same HashFunc, keys from different HashFuncs can't be compared.
+func Diff(old, new *HashRing) []RangeChange {
+	changes := diff(old, new, 1)
+	for i := range changes {
+		changes[i].FromReplicas = nil
+		changes[i].ToReplicas = nil
+	}
+	return changes
+}
+
+// DiffReplicas is like Diff, but compares the list of nodes returned by GetNodesForReplicas
+// instead of the primary owner only. A range is reported when the list differs in members or in order.
+// If a ring has less than numberOfReplicas nodes, all of its nodes are used.
+func DiffReplicas(old, new *HashRing, numberOfReplicas int) []RangeChange {
+	return diff(old, new, numberOfReplicas)
+}
+
+func diff(old, new *HashRing, numberOfReplicas int) []RangeChange {
+	if old == new || numberOfReplicas < 1 {
+		return nil
+	}
+
+	old.mu.RLock()
+	defer old.mu.RUnlock()
+	new.mu.RLock()
+	defer new.mu.RUnlock()
+
+	// every key between two consecutive boundaries has the same owners in both rings
+	boundaries := mergeKeys(old.uniqueKeys(), new.uniqueKeys())
+
+	changes := make([]RangeChange, 0)
+	for i, start := range boundaries {
+		end := boundaries[(i+1)%len(boundaries)]
+		from := old.getNodesForHashKey(start, numberOfReplicas)
+		to := new.getNodesForHashKey(start, numberOfReplicas)
+		if sameNodes(from, to) {
+			continue
+		}
+
+		if last := len(changes) - 1; last >= 0 &&
+			equalKeys(changes[last].End, start) &&
+			sameNodes(changes[last].FromReplicas, from) &&
+			sameNodes(changes[last].ToReplicas, to) {
+			changes[last].End = end
+			continue
+		}
+
+		change := RangeChange{
+			Range:        Range{Start: start, End: end},
+			FromReplicas: from,
+			ToReplicas:   to,
+		}
+		if len(from) > 0 {
+			change.From = from[0]
+		}
+		if len(to) > 0 {
+			change.To = to[0]
+		}
+		changes = append(changes, change)
+	}
+
+	for i := range changes {
+		changes[i].Fraction = changes[i].Range.Fraction()
+	}
+	return changes
+}
+
+// getNodesForHashKey returns up to numberOfReplicas nodes owning the given HashKey, nil for an empty ring.
+// getNodesForHashKey requires RLock(), make sure the caller is doing it
+func (h *HashRing) getNodesForHashKey(key HashKey, numberOfReplicas int) []Node {
+	if len(h.sortedKeys) == 0 {
+		return nil
+	}
+	return h.getNodesFromPos(h.getHashKeyPos(key), numberOfReplicas)
+}
+
+// sameNodes compares two lists of nodes by their String() representation.
+func sameNodes(a, b []Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameNode(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// findChange returns the change covering the given key, if any.
+func findChange(changes []RangeChange, key HashKey) (RangeChange, bool) {
+	for _, change := range changes {
+		if change.Contains(key) {
+			return change, true
+		}
+	}
+	return RangeChange{}, false
+}
+
+func assertDiffMatchesLookups(t *testing.T, old, new *HashRing) {
+	changes := Diff(old, new)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		oldNode, _ := old.GetNode(key)
+		newNode, _ := new.GetNode(key)
+
+		change, moved := findChange(changes, new.GenKey(key))
+		if !assert.Equal(t, oldNode != newNode, moved, key) {
+			return
+		}
+		if moved {
+			assert.Equal(t, oldNode, change.From, key)
+			assert.Equal(t, newNode, change.To, key)
+		}
+	}
+}
+
+func TestDiffAddNode(t *testing.T) {
+	old := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+	new := old.AddNode(myNode("d"))
+
+	changes := Diff(old, new)
+	if assert.Len(t, changes, 1) {
+		assert.Equal(t, myNode("d"), changes[0].To)
+		assert.Nil(t, changes[0].FromReplicas)
+		assert.Greater(t, changes[0].Fraction, 0.0)
+		assert.Less(t, changes[0].Fraction, 1.0)
+	}
+	assertDiffMatchesLookups(t, old, new)
+}
+
+func TestDiffRemoveNode(t *testing.T) {
+	old := New(stringSliceToNodeSlice([]string{"a", "b", "c", "d", "e"}))
+	new := old.RemoveNode(myNode("c"))
+
+	changes := Diff(old, new)
+	for _, change := range changes {
+		assert.Equal(t, myNode("c"), change.From)
+	}
+	assertDiffMatchesLookups(t, old, new)
+	assertDiffMatchesLookups(t, new, old)
+}
+
+func TestDiffSameRing(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+
+	assert.Empty(t, Diff(ring, ring))
+	assert.Empty(t, Diff(ring, New(stringSliceToNodeSlice([]string{"c", "b", "a"}))))
+}
+
+func TestDiffEmptyRing(t *testing.T) {
+	empty := New(stringSliceToNodeSlice([]string{}))
+	ring := New(stringSliceToNodeSlice([]string{"a"}))
+
+	changes := Diff(empty, ring)
+	if assert.Len(t, changes, 1) {
+		assert.Nil(t, changes[0].From)
+		assert.Equal(t, myNode("a"), changes[0].To)
+		assert.Equal(t, 1.0, changes[0].Fraction)
+	}
+	assert.Empty(t, Diff(empty, New(stringSliceToNodeSlice([]string{}))))
+}
+
+func TestDiffReplicas(t *testing.T) {
+	old := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+	new := old.AddNode(myNode("d"))
+
+	changes := DiffReplicas(old, new, 2)
+	assert.Greater(t, len(changes), len(Diff(old, new)))
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		oldNodes, _ := old.GetNodesForReplicas(key, 2)
+		newNodes, _ := new.GetNodesForReplicas(key, 2)
+
+		change, moved := findChange(changes, new.GenKey(key))
+		if !assert.Equal(t, !sameNodes(oldNodes, newNodes), moved, key) {
+			return
+		}
+		if moved {
+			assert.Equal(t, oldNodes, change.FromReplicas, key)
+			assert.Equal(t, newNodes, change.ToReplicas, key)
+		}
+	}
+}
+
+func TestRangeFraction(t *testing.T) {
+	low := &Int64PairHashKey{High: -1 << 62}
+	high := &Int64PairHashKey{High: 1 << 62}
+
+	assert.Equal(t, 0.5, Range{Start: low, End: high}.Fraction())
+	assert.Equal(t, 0.5, Range{Start: high, End: low}.Fraction())
+	assert.Equal(t, 1.0, Range{Start: low, End: low}.Fraction())
+
+	assert.True(t, Range{Start: high, End: low}.Contains(&Int64PairHashKey{High: -1 << 63}))
+	assert.False(t, Range{Start: low, End: high}.Contains(high))
+	assert.True(t, Range{Start: low, End: low}.Contains(high))
+}
@@ -0,0 +1,78 @@
+package hashring
+
+// MarkDown temporarily excludes node from lookups without changing the ring:
+// keys owned by node go to the next node clockwise which isn't down, and every other key
+// keeps its owner. It returns false if node isn't part of the ring or is already down.
+//
+// Unlike every other change, marking nodes down and up modifies h in place instead of
+// generating a new hashring. Rings derived from h afterwards start with the same nodes down.
+// Diff, Ownership and the other functions describing the ring ignore down nodes.
+func (h *HashRing) MarkDown(node Node) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.hasNode(node) || h.down[node.String()] {
+		return false
+	}
+	if h.down == nil {
+		h.down = make(map[string]bool)
+	}
+	h.down[node.String()] = true
+	return true
+}
+
+// MarkUp brings back a node marked down with MarkDown, restoring the exact original mapping.
+// It returns false if node wasn't down.
+func (h *HashRing) MarkUp(node Node) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.down[node.String()] {
+		return false
+	}
+	delete(h.down, node.String())
+	return true
+}
+
+// IsDown reports whether node is marked down.
+func (h *HashRing) IsDown(node Node) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.down[node.String()]
+}
+
+// DownNodes returns the nodes marked down, sorted by their String() representation.
+func (h *HashRing) DownNodes() []Node {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	nodes := make([]Node, 0, len(h.down))
+	for _, node := range h.getUniqueNodes() {
+		if h.down[node.String()] {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// getUpNodesFromPos is like getNodesFromPos, but skips the nodes marked down.
+// getUpNodesFromPos requires RLock(), make sure the caller is doing it
+func (h *HashRing) getUpNodesFromPos(pos int, numberOfReplicas int) []Node {
+	if len(h.down) == 0 {
+		return h.getNodesFromPos(pos, numberOfReplicas)
+	}
+
+	returnedValues := make(map[Node]bool, numberOfReplicas)
+	resultSlice := make([]Node, 0, numberOfReplicas)
+
+	for i := pos; i < pos+len(h.sortedKeys) && len(resultSlice) < numberOfReplicas; i++ {
+		val := h.nodeHashMap[h.sortedKeys[i%len(h.sortedKeys)]]
+		if !returnedValues[val] && !h.down[val.String()] {
+			returnedValues[val] = true
+			resultSlice = append(resultSlice, val)
+		}
+	}
+
+	return resultSlice
+}
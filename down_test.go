@@ -0,0 +1,71 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkDown(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c", "d"}))
+	before := map[string][]Node{}
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		before[key], _ = ring.GetNodesForReplicas(key, 2)
+	}
+
+	assert.True(t, ring.MarkDown(myNode("b")))
+	assert.False(t, ring.MarkDown(myNode("b")))
+	assert.False(t, ring.MarkDown(myNode("x")))
+	assert.True(t, ring.IsDown(myNode("b")))
+	assert.Equal(t, stringSliceToNodeSlice([]string{"b"}), ring.DownNodes())
+
+	// b is skipped like a removed node, without changing the ring
+	removed := ring.RemoveNode(myNode("b"))
+	for key := range before {
+		node, ok := ring.GetNode(key)
+		assert.True(t, ok)
+		expected, _ := removed.GetNode(key)
+		assert.Equal(t, expected, node, key)
+
+		nodes, ok := ring.GetNodesForReplicas(key, 2)
+		assert.True(t, ok)
+		expectedNodes, _ := removed.GetNodesForReplicas(key, 2)
+		assert.Equal(t, expectedNodes, nodes, key)
+
+		nodes, _ = ring.GetNodesForReplicasFor(ForRead, key, 2)
+		assert.Equal(t, expectedNodes, nodes, key)
+	}
+	assert.Empty(t, Diff(ring, New(stringSliceToNodeSlice([]string{"a", "b", "c", "d"}))))
+
+	assert.True(t, ring.MarkUp(myNode("b")))
+	assert.False(t, ring.MarkUp(myNode("b")))
+	for key, expected := range before {
+		nodes, _ := ring.GetNodesForReplicas(key, 2)
+		assert.Equal(t, expected, nodes, key)
+	}
+}
+
+func TestMarkDownAllNodes(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b"}))
+	ring.MarkDown(myNode("a"))
+
+	_, ok := ring.GetNodesForReplicas("test", 2)
+	assert.False(t, ok)
+
+	ring.MarkDown(myNode("b"))
+	_, ok = ring.GetNode("test")
+	assert.False(t, ok)
+}
+
+func TestMarkDownCarriedOver(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b"}))
+	ring.MarkDown(myNode("a"))
+
+	added := ring.AddNode(myNode("c"))
+	assert.True(t, added.IsDown(myNode("a")))
+	assert.Equal(t, ring.Fingerprint(), New(stringSliceToNodeSlice([]string{"a", "b"})).Fingerprint())
+
+	assert.False(t, ring.RemoveNode(myNode("a")).AddNode(myNode("a")).IsDown(myNode("a")))
+}
@@ -0,0 +1,99 @@
+package hashring
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// KeyExtractor derives the part of a key that is hashed to find its node.
+// Keys with the same extracted part are owned by the same nodes.
+// Functions like strings.ToLower can be used as is.
+type KeyExtractor func(key string) string
+
+var extractorRegistry = struct {
+	sync.RWMutex
+	extractors map[string]KeyExtractor
+}{extractors: map[string]KeyExtractor{"hashtag": HashTag}}
+
+// RegisterKeyExtractor makes extractor available under name for restoring snapshots.
+// HashTagExtractor is registered as "hashtag". Registering a name again replaces the previous KeyExtractor.
+func RegisterKeyExtractor(name string, extractor KeyExtractor) {
+	extractorRegistry.Lock()
+	defer extractorRegistry.Unlock()
+
+	extractorRegistry.extractors[name] = extractor
+}
+
+// LookupKeyExtractor returns the KeyExtractor registered under name.
+func LookupKeyExtractor(name string) (KeyExtractor, bool) {
+	extractorRegistry.RLock()
+	defer extractorRegistry.RUnlock()
+
+	extractor, ok := extractorRegistry.extractors[name]
+	return extractor, ok
+}
+
+// WithKeyExtractor returns a ring hashing the keys through extractor in GenKey, GetNode, GetNodesForReplicas
+// and the other lookups. A nil extractor hashes keys as is.
+// name identifies the extractor in the Summary, Fingerprint and Snapshot of the ring, since functions can't
+// be compared: processes must use the same name for the same extractor, and different names for different ones.
+// Restore finds the extractor by name, see RegisterKeyExtractor.
+// The extractor is configuration rather than a membership change: the ring keeps the epoch of h,
+// and the rings derived from it keep the extractor.
+func (h *HashRing) WithKeyExtractor(name string, extractor KeyExtractor) *HashRing {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	nodes := make([]Node, len(h.nodes))
+	copy(nodes, h.nodes)
+	hashRing := h.configure(nodes, h.virtualNodes)
+	hashRing.keyExtractor = extractor
+	hashRing.keyExtractorName = ""
+	if extractor != nil {
+		hashRing.keyExtractorName = name
+	}
+	return hashRing
+}
+
+// HashTagExtractor hashes the Redis hash tag of keys, see HashTag.
+func HashTagExtractor() KeyExtractor {
+	return HashTag
+}
+
+// PrefixExtractor hashes the part of keys before the first delimiter, for instance the tenant
+// of tenant:42:orders with ":" as delimiter. Keys without delimiter are hashed as is.
+func PrefixExtractor(delimiter string) KeyExtractor {
+	return func(key string) string {
+		if i := strings.Index(key, delimiter); i >= 0 && delimiter != "" {
+			return key[:i]
+		}
+		return key
+	}
+}
+
+// RegexpExtractor hashes the first capture group of re, or the whole match if re has no group.
+// Keys not matching re are hashed as is.
+func RegexpExtractor(re *regexp.Regexp) KeyExtractor {
+	return func(key string) string {
+		match := re.FindStringSubmatch(key)
+		switch {
+		case match == nil:
+			return key
+		case len(match) > 1:
+			return match[1]
+		default:
+			return match[0]
+		}
+	}
+}
+
+// ChainExtractors applies extractors in order, the output of one being the input of the next.
+func ChainExtractors(extractors ...KeyExtractor) KeyExtractor {
+	return func(key string) string {
+		for _, extractor := range extractors {
+			key = extractor(key)
+		}
+		return key
+	}
+}
@@ -0,0 +1,68 @@
+package hashring
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractors(t *testing.T) {
+	assert.Equal(t, "user:42", HashTagExtractor()("{user:42}:profile"))
+
+	prefix := PrefixExtractor(":")
+	assert.Equal(t, "tenant", prefix("tenant:42:orders"))
+	assert.Equal(t, "tenant", prefix("tenant"))
+	assert.Equal(t, "a:b", PrefixExtractor("")("a:b"))
+
+	group := RegexpExtractor(regexp.MustCompile(`^orders/(\w+)/`))
+	assert.Equal(t, "acme", group("orders/acme/2024"))
+	assert.Equal(t, "invoices/acme/2024", group("invoices/acme/2024"))
+	assert.Equal(t, "42", RegexpExtractor(regexp.MustCompile(`\d+`))("user-42-profile"))
+
+	chain := ChainExtractors(PrefixExtractor(":"), strings.ToLower)
+	assert.Equal(t, "tenant", chain("TeNaNt:42"))
+}
+
+func TestWithKeyExtractor(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c", "d", "e"}))
+	lower := ring.WithKeyExtractor("lower", strings.ToLower)
+
+	assert.Equal(t, ring.Epoch(), lower.Epoch(), "setting an extractor doesn't advance the epoch")
+	assert.Equal(t, ring.GenKey("key"), lower.GenKey("KEY"))
+
+	expected, _ := ring.GetNode("key")
+	node, _ := lower.GetNode("KeY")
+	assert.Equal(t, expected, node)
+
+	expectedReplicas, _ := ring.GetNodesForReplicas("key", 3)
+	replicas, _ := lower.GetNodesForReplicas("KEY", 3)
+	assert.Equal(t, expectedReplicas, replicas)
+
+	// derived rings keep the extractor
+	added := lower.AddNode(myNode("f"))
+	assert.Equal(t, added.GenKey("key"), added.GenKey("KEY"))
+
+	// the original ring is unchanged
+	assert.NotEqual(t, ring.GenKey("key"), ring.GenKey("KEY"))
+	assert.Equal(t, ring.GenKey("KEY"), lower.WithKeyExtractor("", nil).GenKey("KEY"))
+}
+
+func TestKeyExtractorFingerprint(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+	lower := ring.WithKeyExtractor("lower", strings.ToLower)
+
+	assert.Equal(t, "lower", lower.Summary().KeyExtractor)
+	assert.NotEqual(t, ring.Fingerprint(), lower.Fingerprint())
+	assert.Equal(t, lower.Fingerprint(), ring.WithKeyExtractor("lower", strings.ToLower).Fingerprint())
+	assert.NotEqual(t, lower.Fingerprint(), ring.WithKeyExtractor("prefix", PrefixExtractor(":")).Fingerprint())
+
+	// derived rings keep the name, removing the extractor drops it
+	assert.Equal(t, lower.Fingerprint(), lower.AddNode(myNode("d")).RemoveNode(myNode("d")).Fingerprint())
+	assert.Equal(t, ring.Fingerprint(), lower.WithKeyExtractor("lower", nil).Fingerprint())
+
+	diff := CompareSummaries(ring.Summary(), lower.Summary())
+	assert.Equal(t, SummaryDiff{KeyExtractor: [2]string{"", "lower"}}, diff)
+	assert.Equal(t, `key extractor "" != "lower"`, diff.String())
+}
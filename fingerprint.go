@@ -0,0 +1,204 @@
+package hashring
+
+import (
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RingSummary is what a ring fingerprint is computed from. Processes can exchange summaries
+// to find out why their fingerprints differ, see CompareSummaries.
+type RingSummary struct {
+	Hash         string        `json:"hash"`                   // Hash is the name of the hash function, empty if unknown.
+	KeyExtractor string        `json:"keyExtractor,omitempty"` // KeyExtractor is the name of the key extractor, see WithKeyExtractor.
+	VirtualNodes int           `json:"virtualNodes"`           // VirtualNodes is the number of tokens per node, see WithVirtualNodes.
+	Nodes        []NodeSummary `json:"nodes"`                  // Nodes are sorted by name.
+}
+
+// NodeSummary is a node of a RingSummary and its token on the ring.
+type NodeSummary struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`           // Token is the hex encoded first token, or its %v representation for HashKeys not implementing encoding.BinaryMarshaler.
+	State string `json:"state,omitempty"` // State is the NodeState of the node, empty for active nodes.
+}
+
+// Summary returns the sorted nodes, tokens, states, hash function name, key extractor name and number of
+// virtual nodes of the ring. The other tokens of a node follow from its first one and the number of virtual nodes.
+func (h *HashRing) Summary() RingSummary {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.getSummary()
+}
+
+// getSummary requires RLock(), make sure the caller is doing it
+func (h *HashRing) getSummary() RingSummary {
+	summary := RingSummary{
+		Hash:         h.hashName,
+		KeyExtractor: h.keyExtractorName,
+		VirtualNodes: h.virtualNodes,
+		Nodes:        make([]NodeSummary, 0, len(h.nodes)),
+	}
+	for _, node := range h.getUniqueNodes() {
+		nodeSummary := NodeSummary{
+			Name:  node.String(),
+			Token: formatToken(h.hashFunc([]byte(virtualNodeKey(node, 0)))),
+		}
+		if state := h.getNodeState(node); state != NodeActive {
+			nodeSummary.State = state.String()
+		}
+		summary.Nodes = append(summary.Nodes, nodeSummary)
+	}
+	sort.Slice(summary.Nodes, func(i, j int) bool {
+		return summary.Nodes[i].Name < summary.Nodes[j].Name
+	})
+	return summary
+}
+
+func formatToken(key HashKey) string {
+	if marshaler, ok := key.(encoding.BinaryMarshaler); ok {
+		if bytes, err := marshaler.MarshalBinary(); err == nil {
+			return hex.EncodeToString(bytes)
+		}
+	}
+	return fmt.Sprintf("%v", key)
+}
+
+// Fingerprint returns a deterministic hash of the summary.
+func (s RingSummary) Fingerprint() uint64 {
+	hash := fnv.New64a()
+	// fields are NUL separated so that they can't run into each other
+	hash.Write([]byte(s.Hash))
+	hash.Write([]byte{0})
+	for _, node := range s.Nodes {
+		hash.Write([]byte(node.Name))
+		hash.Write([]byte{0})
+		hash.Write([]byte(node.Token))
+		hash.Write([]byte{0})
+		if node.State != "" {
+			// only written when set, so that rings without states keep their fingerprint
+			hash.Write([]byte(node.State))
+			hash.Write([]byte{0})
+		}
+	}
+	if s.VirtualNodes > 1 {
+		// only written for several virtual nodes, so that rings with one token per node keep their fingerprint
+		hash.Write([]byte("virtualNodes:" + strconv.Itoa(s.VirtualNodes)))
+		hash.Write([]byte{0})
+	}
+	if s.KeyExtractor != "" {
+		// like states, only written when set. The prefix keeps it apart from the node fields
+		hash.Write([]byte("extractor:" + s.KeyExtractor))
+		hash.Write([]byte{0})
+	}
+	return hash.Sum64()
+}
+
+// Fingerprint returns a deterministic hash over the sorted tokens, node names, node states,
+// hash function name, key extractor name and number of virtual nodes of the ring. Rings routing keys the same way in different processes
+// have equal fingerprints, as long as they name their key extractors consistently: the extractor function
+// itself can't be hashed, a ring with an unnamed extractor has the fingerprint of a ring without one.
+// It's computed once per ring.
+func (h *HashRing) Fingerprint() uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.getFingerprint()
+}
+
+// getFingerprint requires RLock(), make sure the caller is doing it
+func (h *HashRing) getFingerprint() uint64 {
+	h.fingerprintOnce.Do(func() {
+		h.fingerprint = h.getSummary().Fingerprint()
+	})
+	return h.fingerprint
+}
+
+// SummaryDiff explains why two ring summaries differ.
+type SummaryDiff struct {
+	Hash         [2]string // Hash holds both hash function names when they differ.
+	KeyExtractor [2]string // KeyExtractor holds both key extractor names when they differ.
+	VirtualNodes [2]int    // VirtualNodes holds both numbers of virtual nodes when they differ.
+	OnlyInA      []string  // OnlyInA are the nodes missing from the second summary.
+	OnlyInB      []string  // OnlyInB are the nodes missing from the first summary.
+	TokenChanged []string  // TokenChanged are the nodes present in both summaries with different tokens.
+	StateChanged []string  // StateChanged are the nodes present in both summaries with different states.
+}
+
+// Equal reports whether no difference was found.
+func (d SummaryDiff) Equal() bool {
+	return d.Hash == [2]string{} && d.KeyExtractor == [2]string{} && d.VirtualNodes == [2]int{} && len(d.OnlyInA) == 0 && len(d.OnlyInB) == 0 && len(d.TokenChanged) == 0 && len(d.StateChanged) == 0
+}
+
+func (d SummaryDiff) String() string {
+	if d.Equal() {
+		return "rings are identical"
+	}
+
+	parts := make([]string, 0, 7)
+	if d.Hash != [2]string{} {
+		parts = append(parts, fmt.Sprintf("hash function %q != %q", d.Hash[0], d.Hash[1]))
+	}
+	if d.KeyExtractor != [2]string{} {
+		parts = append(parts, fmt.Sprintf("key extractor %q != %q", d.KeyExtractor[0], d.KeyExtractor[1]))
+	}
+	if d.VirtualNodes != [2]int{} {
+		parts = append(parts, fmt.Sprintf("virtual nodes %d != %d", d.VirtualNodes[0], d.VirtualNodes[1]))
+	}
+	if len(d.OnlyInA) > 0 {
+		parts = append(parts, "missing from b: "+strings.Join(d.OnlyInA, ", "))
+	}
+	if len(d.OnlyInB) > 0 {
+		parts = append(parts, "missing from a: "+strings.Join(d.OnlyInB, ", "))
+	}
+	if len(d.TokenChanged) > 0 {
+		parts = append(parts, "different tokens: "+strings.Join(d.TokenChanged, ", "))
+	}
+	if len(d.StateChanged) > 0 {
+		parts = append(parts, "different states: "+strings.Join(d.StateChanged, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// CompareSummaries explains the difference between the rings a and b were taken from.
+func CompareSummaries(a, b RingSummary) SummaryDiff {
+	var diff SummaryDiff
+	if a.Hash != b.Hash {
+		diff.Hash = [2]string{a.Hash, b.Hash}
+	}
+	if a.KeyExtractor != b.KeyExtractor {
+		diff.KeyExtractor = [2]string{a.KeyExtractor, b.KeyExtractor}
+	}
+	if a.VirtualNodes != b.VirtualNodes {
+		diff.VirtualNodes = [2]int{a.VirtualNodes, b.VirtualNodes}
+	}
+
+	others := make(map[string]NodeSummary, len(b.Nodes))
+	for _, node := range b.Nodes {
+		others[node.Name] = node
+	}
+	for _, node := range a.Nodes {
+		other, ok := others[node.Name]
+		if !ok {
+			diff.OnlyInA = append(diff.OnlyInA, node.Name)
+			continue
+		}
+		if other.Token != node.Token {
+			diff.TokenChanged = append(diff.TokenChanged, node.Name)
+		}
+		if other.State != node.State {
+			diff.StateChanged = append(diff.StateChanged, node.Name)
+		}
+		delete(others, node.Name)
+	}
+	for _, node := range b.Nodes {
+		if _, ok := others[node.Name]; ok {
+			diff.OnlyInB = append(diff.OnlyInB, node.Name)
+		}
+	}
+	return diff
+}
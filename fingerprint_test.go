@@ -0,0 +1,44 @@
+package hashring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+
+	assert.Equal(t, ring.Fingerprint(), New(stringSliceToNodeSlice([]string{"c", "a", "b", "a"})).Fingerprint())
+	assert.Equal(t, ring.Fingerprint(), ring.AddNode(myNode("d")).RemoveNode(myNode("d")).Fingerprint())
+	assert.NotEqual(t, ring.Fingerprint(), ring.AddNode(myNode("d")).Fingerprint())
+
+	sha1Ring, _ := NewWithHashName(stringSliceToNodeSlice([]string{"a", "b", "c"}), "sha1")
+	assert.NotEqual(t, ring.Fingerprint(), sha1Ring.Fingerprint())
+
+	virtual := ring.WithVirtualNodes(16)
+	assert.NotEqual(t, ring.Fingerprint(), virtual.Fingerprint())
+	assert.Equal(t, virtual.Fingerprint(), New(stringSliceToNodeSlice([]string{"a", "b", "c"})).WithVirtualNodes(16).Fingerprint())
+
+	diff := CompareSummaries(ring.Summary(), virtual.Summary())
+	assert.Equal(t, SummaryDiff{VirtualNodes: [2]int{1, 16}}, diff)
+	assert.Equal(t, "virtual nodes 1 != 16", diff.String())
+}
+
+func TestCompareSummaries(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+
+	diff := CompareSummaries(ring.Summary(), ring.Summary())
+	assert.True(t, diff.Equal())
+	assert.Equal(t, "rings are identical", diff.String())
+
+	other := ring.RemoveNode(myNode("a")).AddNode(myNode("d"))
+	diff = CompareSummaries(ring.Summary(), other.Summary())
+	assert.Equal(t, SummaryDiff{OnlyInA: []string{"a"}, OnlyInB: []string{"d"}}, diff)
+	assert.Equal(t, "missing from b: a; missing from a: d", diff.String())
+
+	sha1Ring, _ := NewWithHashName(stringSliceToNodeSlice([]string{"a", "b", "c"}), "sha1")
+	diff = CompareSummaries(ring.Summary(), sha1Ring.Summary())
+	assert.Equal(t, SummaryDiff{Hash: [2]string{"md5", "sha1"}, TokenChanged: []string{"a", "b", "c"}}, diff)
+	assert.Equal(t, `hash function "md5" != "sha1"; different tokens: a, b, c`, diff.String())
+}
@@ -1,10 +1,75 @@
 package hashring
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"fmt"
 	"hash"
+	"hash/fnv"
+	"sort"
+	"sync"
 )
 
+// defaultHashName is the name of the HashFunc used by New.
+const defaultHashName = "md5"
+
+var hashRegistry = struct {
+	sync.RWMutex
+	funcs map[string]HashFunc
+}{funcs: make(map[string]HashFunc)}
+
+func init() {
+	RegisterHash(defaultHashName, defaultHashFunc)
+
+	builtins := map[string]func() hash.Hash{
+		"sha1":    sha1.New,
+		"sha256":  sha256.New,
+		"sha512":  sha512.New,
+		"fnv128a": fnv.New128a,
+	}
+	for name, hasher := range builtins {
+		hashFunc, err := NewHash(hasher).FirstBytes(16).Use(NewInt64PairHashKey)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create %s hashFunc: %s", name, err.Error()))
+		}
+		RegisterHash(name, hashFunc)
+	}
+}
+
+// RegisterHash makes hashFunc available under name for NewWithHashName and for restoring snapshots.
+// md5 (the default), sha1, sha256, sha512 and fnv128a are registered out of the box,
+// all of them producing Int64PairHashKey keys from their first 16 bytes.
+// Registering a name again replaces the previous HashFunc.
+func RegisterHash(name string, hashFunc HashFunc) {
+	hashRegistry.Lock()
+	defer hashRegistry.Unlock()
+
+	hashRegistry.funcs[name] = hashFunc
+}
+
+// LookupHash returns the HashFunc registered under name.
+func LookupHash(name string) (HashFunc, bool) {
+	hashRegistry.RLock()
+	defer hashRegistry.RUnlock()
+
+	hashFunc, ok := hashRegistry.funcs[name]
+	return hashFunc, ok
+}
+
+// HashNames returns the sorted names of all registered hash functions.
+func HashNames() []string {
+	hashRegistry.RLock()
+	defer hashRegistry.RUnlock()
+
+	names := make([]string, 0, len(hashRegistry.funcs))
+	for name := range hashRegistry.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // HashSum allows to use a builder pattern to create different HashFunc objects.
 // See examples for details.
 type HashSum struct {
@@ -0,0 +1,248 @@
+// Package hashcache is a distributed read-through cache sharded by a hashring.
+//
+// Every process runs a Cache and serves it over HTTP to its peers. A key is only cached by the peer owning it
+// on the ring: other peers forward their misses to the owner, which loads the value once with its Getter
+// however many peers ask for it concurrently.
+//
+//	picker := hashpeer.NewPicker(holder, "10.0.0.1:8080")
+//	cache := hashcache.New(picker, hashcache.GetterFunc(loadFromDatabase), hashcache.Options{})
+//	http.Handle(hashcache.DefaultBasePath, cache)
+//	value, err := cache.Get(ctx, "user:42")
+package hashcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mugli/hashring"
+	"github.com/mugli/hashring/hashpeer"
+)
+
+// DefaultBasePath is the path the peers are served under by default.
+const DefaultBasePath = "/_hashcache/"
+
+// DefaultLoadTimeout bounds the loads by default.
+const DefaultLoadTimeout = 30 * time.Second
+
+// Getter loads the value of a key missing from the cache, for instance from a database.
+type Getter interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// GetterFunc adapts a function to a Getter.
+type GetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f GetterFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// Options configures a Cache.
+type Options struct {
+	BasePath    string                          // BasePath is the path the peers are served under, DefaultBasePath by default.
+	Client      *http.Client                    // Client fetches keys from the peers, http.DefaultClient if nil.
+	URL         func(peer hashring.Node) string // URL returns the base URL of a peer, "http://" + peer.String() + BasePath if nil.
+	MaxEntries  int                             // MaxEntries is the number of values kept by the cache, 10000 by default.
+	LoadTimeout time.Duration                   // LoadTimeout bounds the loads shared by concurrent Gets of a key, DefaultLoadTimeout by default.
+}
+
+// Stats are counters of a Cache.
+type Stats struct {
+	Gets       int64 // Gets is the number of calls to Get.
+	Hits       int64 // Hits is the number of Gets served from the local cache.
+	Loads      int64 // Loads is the number of values loaded with the Getter.
+	PeerLoads  int64 // PeerLoads is the number of values fetched from a peer.
+	PeerErrors int64 // PeerErrors is the number of peers that couldn't be reached, their keys are loaded locally.
+	ServerGets int64 // ServerGets is the number of keys requested by peers.
+}
+
+// Cache is a peer of a distributed cache. It's an http.Handler serving the keys it owns to the other peers.
+type Cache struct {
+	picker  *hashpeer.Picker
+	getter  Getter
+	options Options
+	flight  flightGroup // flight shares the loads of Get
+	served  flightGroup // served shares the loads of the keys requested by peers
+
+	mu    sync.Mutex
+	lru   *lru
+	stats Stats
+}
+
+// New creates a Cache loading the keys owned by the local peer of picker with getter.
+func New(picker *hashpeer.Picker, getter Getter, options Options) *Cache {
+	if options.BasePath == "" {
+		options.BasePath = DefaultBasePath
+	}
+	if !strings.HasSuffix(options.BasePath, "/") {
+		options.BasePath += "/"
+	}
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = 10000
+	}
+	if options.LoadTimeout <= 0 {
+		options.LoadTimeout = DefaultLoadTimeout
+	}
+	return &Cache{
+		picker:  picker,
+		getter:  getter,
+		options: options,
+		flight:  flightGroup{timeout: options.LoadTimeout},
+		served:  flightGroup{timeout: options.LoadTimeout},
+		lru:     newLRU(options.MaxEntries),
+	}
+}
+
+// Get returns the value of key, from the local cache, the peer owning key or the Getter.
+// Keys owned by unreachable peers are loaded locally, without being cached.
+// Concurrent Gets of a key share a single load, bounded by LoadTimeout rather than by ctx:
+// a Get returns ctx.Err() once ctx is done, the load keeps going for the other callers.
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	c.stats.Gets++
+	value, ok := c.lru.get(key)
+	if ok {
+		c.stats.Hits++
+	}
+	c.mu.Unlock()
+	if ok {
+		return value, nil
+	}
+
+	return c.flight.do(ctx, key, func(ctx context.Context) ([]byte, error) {
+		if peer, ok := c.picker.PickPeer(key); ok {
+			value, err := c.fetch(ctx, peer, key)
+			if err == nil || !errors.Is(err, errUnreachable) {
+				return value, err
+			}
+			c.count(func(stats *Stats) { stats.PeerErrors++ })
+			return c.load(ctx, key, false)
+		}
+		return c.load(ctx, key, true)
+	})
+}
+
+// Remove removes key from the local cache. Other peers aren't notified.
+func (c *Cache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.remove(key)
+}
+
+// Len returns the number of values in the local cache.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.len()
+}
+
+// Stats returns the counters of the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+func (c *Cache) count(update func(stats *Stats)) {
+	c.mu.Lock()
+	update(&c.stats)
+	c.mu.Unlock()
+}
+
+// load loads key with the Getter, and caches it if store is true.
+func (c *Cache) load(ctx context.Context, key string, store bool) ([]byte, error) {
+	value, err := c.getter.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Loads++
+	if store {
+		c.lru.add(key, value)
+	}
+	return value, nil
+}
+
+// errUnreachable wraps the errors of peers that couldn't be reached.
+var errUnreachable = errors.New("peer unreachable")
+
+func (c *Cache) fetch(ctx context.Context, peer hashring.Node, key string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.peerURL(peer)+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("hashcache: %w", err)
+	}
+	resp, err := c.options.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("hashcache: %w: %s", errUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("hashcache: %w: %s", errUnreachable, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("hashcache: peer %s: %s: %s", peer, resp.Status, strings.TrimSpace(string(body)))
+	}
+	c.count(func(stats *Stats) { stats.PeerLoads++ })
+	return body, nil
+}
+
+func (c *Cache) peerURL(peer hashring.Node) string {
+	if c.options.URL != nil {
+		return c.options.URL(peer)
+	}
+	return "http://" + peer.String() + c.options.BasePath
+}
+
+// ServeHTTP serves the keys requested by peers at BasePath + the escaped key. Keys are always loaded locally,
+// never forwarded again, so peers with different views of the ring can't loop. Their loads don't share
+// the ones of Get either: a Get of the same key may be waiting on the peer making the request, which would
+// then wait on itself until LoadTimeout.
+func (c *Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.EscapedPath(), c.options.BasePath) {
+		http.NotFound(w, r)
+		return
+	}
+	key, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), c.options.BasePath))
+	if err != nil || key == "" {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	c.stats.ServerGets++
+	value, ok := c.lru.get(key)
+	c.mu.Unlock()
+	if !ok {
+		value, err = c.served.do(r.Context(), key, func(ctx context.Context) ([]byte, error) {
+			return c.load(ctx, key, c.picker.IsLocal(key))
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(value)
+}
@@ -0,0 +1,291 @@
+package hashcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mugli/hashring"
+	"github.com/mugli/hashring/hashpeer"
+	"github.com/stretchr/testify/assert"
+)
+
+// loads counts the loads of every key.
+type loads struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (l *loads) getter(name string) Getter {
+	return GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.counts == nil {
+			l.counts = make(map[string]int)
+		}
+		l.counts[key]++
+		if key == "error" {
+			return nil, errors.New("load failed")
+		}
+		return []byte("value of " + key), nil
+	})
+}
+
+func (l *loads) count(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.counts[key]
+}
+
+// startPeers starts n caches on loopback listeners sharing a holder.
+func startPeers(t *testing.T, n int, getter func(name string) Getter) (map[string]*Cache, map[string]*httptest.Server, *hashring.Holder) {
+	holder := hashring.NewHolder(hashring.New([]hashring.Node{}))
+	caches := make(map[string]*Cache, n)
+	servers := make(map[string]*httptest.Server, n)
+	for i := 0; i < n; i++ {
+		var cache *Cache
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cache.ServeHTTP(w, r)
+		}))
+		t.Cleanup(server.Close)
+		name := server.Listener.Addr().String()
+		cache = New(hashpeer.NewPicker(holder, name), getter(name), Options{})
+		caches[name] = cache
+		servers[name] = server
+		holder.AddNode(hashring.StringNode(name))
+	}
+	return caches, servers, holder
+}
+
+func TestCacheLoadsKeysOnOwner(t *testing.T) {
+	counts := &loads{}
+	caches, _, holder := startPeers(t, 3, counts.getter)
+
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("key/%d", i)
+		for _, cache := range caches {
+			value, err := cache.Get(context.Background(), key)
+			assert.NoError(t, err)
+			assert.Equal(t, "value of "+key, string(value))
+		}
+		assert.Equal(t, 1, counts.count(key), "keys are loaded once, by their owner")
+
+		owner, _ := holder.Ring().GetNode(key)
+		for name, cache := range caches {
+			_, cached := cache.lru.get(key)
+			assert.Equal(t, name == owner.String(), cached, "keys are only cached by their owner")
+		}
+	}
+
+	total := Stats{}
+	for _, cache := range caches {
+		stats := cache.Stats()
+		total.Gets += stats.Gets
+		total.Loads += stats.Loads
+		total.PeerLoads += stats.PeerLoads
+	}
+	assert.Equal(t, int64(90), total.Gets)
+	assert.Equal(t, int64(30), total.Loads)
+	assert.Equal(t, int64(60), total.PeerLoads)
+}
+
+func TestCacheErrors(t *testing.T) {
+	counts := &loads{}
+	caches, _, holder := startPeers(t, 2, counts.getter)
+	owner, _ := holder.Ring().GetNode("error")
+
+	for name, cache := range caches {
+		_, err := cache.Get(context.Background(), "error")
+		assert.Error(t, err, name)
+	}
+	assert.Equal(t, 2, counts.count("error"), "errors aren't cached")
+	assert.Equal(t, 0, caches[owner.String()].Len())
+}
+
+func TestCacheFallsBackOnUnreachablePeer(t *testing.T) {
+	counts := &loads{}
+	caches, servers, holder := startPeers(t, 2, counts.getter)
+	owner, _ := holder.Ring().GetNode("key")
+	servers[owner.String()].Close()
+
+	for name, cache := range caches {
+		if name == owner.String() {
+			continue
+		}
+		value, err := cache.Get(context.Background(), "key")
+		assert.NoError(t, err)
+		assert.Equal(t, "value of key", string(value))
+		assert.Equal(t, int64(1), cache.Stats().PeerErrors)
+		assert.Equal(t, 0, cache.Len(), "keys of other peers aren't cached")
+	}
+}
+
+func TestCachePeersDisagreeingOnOwner(t *testing.T) {
+	// both getters must be running at once, so that each Get is in flight while its peer serves the key
+	started := make(chan struct{}, 2)
+	getter := func(name string) Getter {
+		return GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+			started <- struct{}{}
+			for len(started) < 2 {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(time.Millisecond):
+				}
+			}
+			return []byte(name), nil
+		})
+	}
+
+	servers := make([]*httptest.Server, 2)
+	caches := make([]*Cache, 2)
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			caches[i].ServeHTTP(w, r)
+		}))
+		t.Cleanup(servers[i].Close)
+	}
+	for i := range caches {
+		// each peer believes the other one owns every key
+		self := servers[i].Listener.Addr().String()
+		other := hashring.StringNode(servers[1-i].Listener.Addr().String())
+		holder := hashring.NewHolder(hashring.New([]hashring.Node{other}))
+		caches[i] = New(hashpeer.NewPicker(holder, self), getter(self), Options{LoadTimeout: 5 * time.Second})
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, cache := range caches {
+		wg.Add(1)
+		go func(i int, cache *Cache) {
+			defer wg.Done()
+			value, err := cache.Get(context.Background(), "key")
+			assert.NoError(t, err)
+			assert.Equal(t, servers[1-i].Listener.Addr().String(), string(value), "keys are loaded by the peer asked")
+		}(i, cache)
+	}
+	wg.Wait()
+	assert.Less(t, time.Since(start), time.Second, "peers don't wait on each other until LoadTimeout")
+}
+
+func TestCacheDeduplicatesLoads(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	loaded := 0
+	cache := New(hashpeer.NewPicker(hashring.NewHolder(hashring.New([]hashring.Node{hashring.StringNode("self")})), "self"),
+		GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+			mu.Lock()
+			loaded++
+			mu.Unlock()
+			<-release
+			return []byte(key), nil
+		}), Options{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := cache.Get(context.Background(), "key")
+			assert.NoError(t, err)
+			assert.Equal(t, "key", string(value))
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, 1, loaded)
+	assert.Equal(t, int64(1), cache.Stats().Loads)
+}
+
+func TestCacheCancelledGetDoesNotFailLoad(t *testing.T) {
+	release := make(chan struct{})
+	loadErr := make(chan error, 1)
+	cache := New(hashpeer.NewPicker(hashring.NewHolder(hashring.New([]hashring.Node{hashring.StringNode("self")})), "self"),
+		GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+			<-release
+			loadErr <- ctx.Err()
+			return []byte(key), nil
+		}), Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := cache.Get(ctx, "key")
+		first <- err
+	}()
+	second := make(chan []byte, 1)
+	go func() {
+		value, err := cache.Get(context.Background(), "key")
+		assert.NoError(t, err)
+		second <- value
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// the first caller gives up without waiting for the load
+	cancel()
+	assert.ErrorIs(t, <-first, context.Canceled)
+
+	close(release)
+	assert.Equal(t, "key", string(<-second))
+	assert.NoError(t, <-loadErr, "the load doesn't run on the context of the first caller")
+	assert.Equal(t, int64(1), cache.Stats().Loads)
+}
+
+func TestCacheLoadTimeout(t *testing.T) {
+	cache := New(hashpeer.NewPicker(hashring.NewHolder(hashring.New([]hashring.Node{hashring.StringNode("self")})), "self"),
+		GetterFunc(func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}), Options{LoadTimeout: 20 * time.Millisecond})
+
+	_, err := cache.Get(context.Background(), "key")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	counts := &loads{}
+	cache := New(hashpeer.NewPicker(hashring.NewHolder(hashring.New([]hashring.Node{hashring.StringNode("self")})), "self"),
+		counts.getter("self"), Options{MaxEntries: 2})
+
+	for _, key := range []string{"a", "b", "a", "c", "a", "b"} {
+		_, err := cache.Get(context.Background(), key)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 1, counts.count("a"))
+	assert.Equal(t, 2, counts.count("b"), "b is evicted by c")
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Remove("a")
+	_, _ = cache.Get(context.Background(), "a")
+	assert.Equal(t, 2, counts.count("a"))
+}
+
+func TestCacheServeHTTP(t *testing.T) {
+	counts := &loads{}
+	cache := New(hashpeer.NewPicker(hashring.NewHolder(hashring.New([]hashring.Node{hashring.StringNode("self")})), "self"),
+		counts.getter("self"), Options{BasePath: "/cache"})
+
+	for target, code := range map[string]int{
+		"/cache/a%2Fb": http.StatusOK,
+		"/cache/":      http.StatusBadRequest,
+		"/other/a":     http.StatusNotFound,
+		"/cache/error": http.StatusInternalServerError,
+	} {
+		rec := httptest.NewRecorder()
+		cache.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, code, rec.Code, target)
+	}
+	assert.Equal(t, 1, counts.count("a/b"))
+
+	rec := httptest.NewRecorder()
+	cache.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/cache/a", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
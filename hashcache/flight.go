@@ -0,0 +1,58 @@
+package hashcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// call is a load in progress or completed.
+type call struct {
+	done  chan struct{} // done is closed once value and err are set
+	value []byte
+	err   error
+}
+
+// flightGroup de-duplicates concurrent loads of the same key.
+type flightGroup struct {
+	timeout time.Duration // timeout bounds every load
+
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// do calls load once for all the concurrent callers with the same key, and returns its result to all of them.
+// load runs on a context of its own cancelled after the timeout of the group, not on the context of a caller:
+// every caller waits for the result until its ctx is done, without failing the load for the others.
+func (g *flightGroup) do(ctx context.Context, key string, load func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.run(key, c, load)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (g *flightGroup) run(key string, c *call, load func(ctx context.Context) ([]byte, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), g.timeout)
+	defer cancel()
+
+	c.value, c.err = load(ctx)
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(c.done)
+}
@@ -0,0 +1,57 @@
+package hashcache
+
+import "container/list"
+
+type entry struct {
+	key   string
+	value []byte
+}
+
+// lru is a cache evicting the least recently used entries beyond maxEntries. It's not safe for concurrent use.
+type lru struct {
+	maxEntries int
+	order      *list.List // order holds the entries, the most recently used first
+	entries    map[string]*list.Element
+}
+
+func newLRU(maxEntries int) *lru {
+	return &lru{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *lru) get(key string) ([]byte, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*entry).value, true
+}
+
+func (c *lru) add(key string, value []byte) {
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		element.Value.(*entry).value = value
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry{key: key, value: value})
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+}
+
+func (c *lru) remove(key string) {
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+func (c *lru) len() int {
+	return c.order.Len()
+}
@@ -0,0 +1,136 @@
+// Package hashgrpc is a gRPC client-side load balancer sending every RPC to the SubConn owning its key
+// on a hashring, for sticky routing to stateful services.
+//
+// The balancer is registered under a name and selected with a service config:
+//
+//	hashgrpc.Register(hashgrpc.Options{Key: hashgrpc.MetadataKey("x-shard")})
+//	conn, err := grpc.Dial(target, grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"hashring": {}}]}`), ...)
+package hashgrpc
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/mugli/hashring"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/metadata"
+)
+
+// Name is the name the balancer is registered under by default.
+const Name = "hashring"
+
+// KeyFunc returns the routing key of an RPC. ok is false for RPCs without key.
+type KeyFunc func(ctx context.Context, fullMethod string) (key string, ok bool)
+
+// MetadataKey reads the routing key from the outgoing metadata name of the RPC.
+func MetadataKey(name string) KeyFunc {
+	return func(ctx context.Context, _ string) (string, bool) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		values := md.Get(name)
+		if len(values) == 0 || values[0] == "" {
+			return "", false
+		}
+		return values[0], true
+	}
+}
+
+type contextKey struct{}
+
+// WithKey returns a context carrying the routing key of the RPCs made with it, see ContextKey.
+func WithKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// ContextKey reads the routing key set by WithKey.
+func ContextKey(ctx context.Context, _ string) (string, bool) {
+	key, ok := ctx.Value(contextKey{}).(string)
+	return key, ok && key != ""
+}
+
+// Options configures the balancer.
+type Options struct {
+	Name string  // Name the balancer is registered under, Name by default.
+	Key  KeyFunc // Key returns the routing key of the RPCs, ContextKey by default.
+	Hash string  // Hash is the name of the hash function of the ring, see hashring.RegisterHash. md5 by default.
+}
+
+// NewBuilder creates a balancer.Builder. The ring is made of the addresses of the ready SubConns,
+// it's rebuilt every time a SubConn changes state. RPCs without key are spread round-robin.
+func NewBuilder(options Options) (balancer.Builder, error) {
+	if options.Name == "" {
+		options.Name = Name
+	}
+	if options.Key == nil {
+		options.Key = ContextKey
+	}
+	if options.Hash == "" {
+		options.Hash = "md5"
+	}
+	if _, ok := hashring.LookupHash(options.Hash); !ok {
+		return nil, fmt.Errorf("hashgrpc: hash function %q is not registered", options.Hash)
+	}
+	return base.NewBalancerBuilder(options.Name, &pickerBuilder{options: options}, base.Config{}), nil
+}
+
+// Register creates a balancer.Builder and registers it with balancer.Register.
+// Like balancer.Register, it must only be called at initialization time.
+func Register(options Options) error {
+	builder, err := NewBuilder(options)
+	if err != nil {
+		return err
+	}
+	balancer.Register(builder)
+	return nil
+}
+
+type pickerBuilder struct {
+	options Options
+}
+
+func (b *pickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	subConns := make(map[string]balancer.SubConn, len(info.ReadySCs))
+	nodes := make([]hashring.Node, 0, len(info.ReadySCs))
+	for subConn, subConnInfo := range info.ReadySCs {
+		addr := subConnInfo.Address.Addr
+		if _, ok := subConns[addr]; !ok {
+			nodes = append(nodes, hashring.StringNode(addr))
+		}
+		subConns[addr] = subConn
+	}
+	ring, err := hashring.NewWithHashName(nodes, b.options.Hash)
+	if err != nil {
+		return base.NewErrPicker(err)
+	}
+
+	return &picker{
+		key:      b.options.Key,
+		ring:     ring,
+		nodes:    ring.Nodes(),
+		subConns: subConns,
+	}
+}
+
+type picker struct {
+	key      KeyFunc
+	ring     *hashring.HashRing
+	nodes    []hashring.Node // nodes are the ring nodes sorted, for RPCs without key
+	subConns map[string]balancer.SubConn
+	next     uint32
+}
+
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	var node hashring.Node
+	if key, ok := p.key(info.Ctx, info.FullMethodName); ok {
+		// the ring is made of the ready SubConns, it's never empty nor marked down
+		node, _ = p.ring.GetNode(key)
+	} else {
+		node = p.nodes[int((atomic.AddUint32(&p.next, 1)-1)%uint32(len(p.nodes)))]
+	}
+	return balancer.PickResult{SubConn: p.subConns[node.String()]}, nil
+}
@@ -0,0 +1,143 @@
+package hashgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mugli/hashring"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startServers starts in-process health servers answering with their address in the "server" header.
+func startServers(t *testing.T, addrs ...string) (map[string]*grpc.Server, map[string]*bufconn.Listener) {
+	servers := make(map[string]*grpc.Server, len(addrs))
+	listeners := make(map[string]*bufconn.Listener, len(addrs))
+	for _, addr := range addrs {
+		addr := addr
+		listener := bufconn.Listen(1 << 16)
+		server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			_ = grpc.SetHeader(ctx, metadata.Pairs("server", addr))
+			return handler(ctx, req)
+		}))
+		healthpb.RegisterHealthServer(server, health.NewServer())
+		go func() { _ = server.Serve(listener) }()
+		t.Cleanup(server.Stop)
+		servers[addr] = server
+		listeners[addr] = listener
+	}
+	return servers, listeners
+}
+
+func dial(t *testing.T, name string, listeners map[string]*bufconn.Listener, addrs ...string) (*grpc.ClientConn, *manual.Resolver) {
+	r := manual.NewBuilderWithScheme("hashgrpc")
+	state := resolver.State{}
+	for _, addr := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	r.InitialState(state)
+
+	conn, err := grpc.Dial("hashgrpc:///test",
+		grpc.WithResolvers(r),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return listeners[addr].DialContext(ctx)
+		}),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"`+name+`": {}}]}`),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn, r
+}
+
+// check calls the health service and returns the address of the server which answered.
+func check(t *testing.T, conn *grpc.ClientConn, ctx context.Context) string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var header metadata.MD
+	_, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header), grpc.WaitForReady(true))
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	return header.Get("server")[0]
+}
+
+func TestBalancerRoutesByKey(t *testing.T) {
+	assert.NoError(t, Register(Options{Name: "hashring-metadata", Key: MetadataKey("x-shard")}))
+	addrs := []string{"s1", "s2", "s3"}
+	_, listeners := startServers(t, addrs...)
+	conn, _ := dial(t, "hashring-metadata", listeners, addrs...)
+
+	ring := hashring.New([]hashring.Node{hashring.StringNode("s1"), hashring.StringNode("s2"), hashring.StringNode("s3")})
+	// wait for all the SubConns to be ready
+	assert.Eventually(t, func() bool {
+		for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+			owner, _ := ring.GetNode(key)
+			if check(t, conn, metadata.AppendToOutgoingContext(context.Background(), "x-shard", key)) != owner.String() {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// RPCs without key are spread over all the servers
+	seen := make(map[string]bool)
+	for i := 0; i < 6; i++ {
+		seen[check(t, conn, context.Background())] = true
+	}
+	assert.Len(t, seen, 3)
+}
+
+func TestBalancerRebuildsRing(t *testing.T) {
+	assert.NoError(t, Register(Options{Name: "hashring-context"}))
+	servers, listeners := startServers(t, "s1", "s2")
+	conn, r := dial(t, "hashring-context", listeners, "s1", "s2")
+
+	ring := hashring.New([]hashring.Node{hashring.StringNode("s1"), hashring.StringNode("s2")})
+	key := "key"
+	owner, _ := ring.GetNode(key)
+	other, _ := ring.RemoveNode(owner).GetNode(key)
+	assert.Eventually(t, func() bool {
+		return check(t, conn, WithKey(context.Background(), key)) == owner.String()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the owner is stopped, its SubConn isn't ready anymore and the key moves
+	servers[owner.String()].Stop()
+	assert.Eventually(t, func() bool {
+		return check(t, conn, WithKey(context.Background(), key)) == other.String()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the resolver removes the address, the key stays on the remaining server
+	r.UpdateState(resolver.State{Addresses: []resolver.Address{{Addr: other.String()}}})
+	assert.Equal(t, other.String(), check(t, conn, WithKey(context.Background(), key)))
+}
+
+func TestNewBuilderRejectsUnknownHash(t *testing.T) {
+	_, err := NewBuilder(Options{Hash: "crc"})
+	assert.Error(t, err)
+}
+
+func TestKeyFuncs(t *testing.T) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-shard", "a")
+	key, ok := MetadataKey("x-shard")(ctx, "/svc/Method")
+	assert.True(t, ok)
+	assert.Equal(t, "a", key)
+	_, ok = MetadataKey("x-other")(ctx, "/svc/Method")
+	assert.False(t, ok)
+
+	key, ok = ContextKey(WithKey(ctx, "b"), "/svc/Method")
+	assert.True(t, ok)
+	assert.Equal(t, "b", key)
+	_, ok = ContextKey(ctx, "/svc/Method")
+	assert.False(t, ok)
+}
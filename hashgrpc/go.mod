@@ -0,0 +1,24 @@
+module github.com/mugli/hashring/hashgrpc
+
+go 1.18
+
+require (
+	github.com/mugli/hashring v0.0.0-20261018221923-76bbeebdaab2
+	github.com/stretchr/testify v1.7.2
+	google.golang.org/grpc v1.56.3
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.9.0 // indirect
+	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// replace builds against the local checkout during development, it's ignored by the modules requiring hashgrpc.
+replace github.com/mugli/hashring => ../
@@ -0,0 +1,246 @@
+package hashhttp
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+
+	"github.com/mugli/hashring"
+)
+
+// ProxyOptions configures a Proxy.
+type ProxyOptions struct {
+	Key       KeyFunc                         // Key extracts the routing key of the requests.
+	Transport http.RoundTripper               // Transport sends the requests upstream, http.DefaultTransport if nil.
+	Scheme    string                          // Scheme of the upstream URLs, "http" by default.
+	Host      func(node hashring.Node) string // Host returns the host:port of a node, node.String() if nil.
+	Replicas  int                             // Replicas is the number of upstreams tried per request, 2 by default.
+
+	// LoadFactor enables consistent hashing with bounded loads when greater than 1: an upstream
+	// serving more than LoadFactor times the average number of in-flight requests is skipped
+	// in favor of the next one on the ring. Bounded loads are disabled by default.
+	LoadFactor float64
+
+	// NewNode creates the nodes added through the admin handler, a node named after the upstream by default.
+	NewNode func(name string) hashring.Node
+}
+
+// Proxy is a reverse proxy sharding requests to the nodes of a holder by a routing key.
+//
+// Nodes marked down in the holder, for instance by a health.Monitor, are skipped, and node states are honored
+// like by Transport, see RequestPurpose. Requests failing to reach
+// their upstream are sent to the next replica of their key, unless they have a body since it's already consumed.
+type Proxy struct {
+	holder  *hashring.Holder
+	options ProxyOptions
+	proxy   *httputil.ReverseProxy
+
+	mu    sync.Mutex
+	loads map[string]int // loads are the in-flight requests by node
+	total int
+}
+
+type upstream struct {
+	node hashring.Node
+	err  error
+}
+
+type upstreamKey struct{}
+
+// NewProxy creates a Proxy sending requests to the nodes of holder.
+func NewProxy(holder *hashring.Holder, options ProxyOptions) *Proxy {
+	if options.Scheme == "" {
+		options.Scheme = "http"
+	}
+	if options.Replicas <= 0 {
+		options.Replicas = 2
+	}
+	if options.NewNode == nil {
+		options.NewNode = func(name string) hashring.Node { return hashring.StringNode(name) }
+	}
+
+	p := &Proxy{
+		holder:  holder,
+		options: options,
+		loads:   make(map[string]int),
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			target := r.Context().Value(upstreamKey{}).(*upstream)
+			r.URL.Scheme = p.options.Scheme
+			r.URL.Host = p.host(target.node)
+		},
+		Transport: options.Transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			// nothing is written yet, ServeHTTP decides whether to try another upstream
+			r.Context().Value(upstreamKey{}).(*upstream).err = err
+		},
+	}
+	return p
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key, err := p.options.Key(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	nodes := p.upstreams(RequestPurpose(r), key)
+	if len(nodes) == 0 {
+		http.Error(w, ErrNoBackend.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	retryable := r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0
+
+	for i, node := range nodes {
+		if i > 0 && (!retryable || r.Context().Err() != nil) {
+			break
+		}
+
+		target := &upstream{node: node}
+		p.acquire(node)
+		p.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), upstreamKey{}, target)))
+		p.release(node)
+		if target.err == nil {
+			return
+		}
+	}
+	http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+}
+
+// upstreams returns the nodes to try for key and purpose, in order. With bounded loads, the first node
+// is the first one on the ring under the load limit.
+func (p *Proxy) upstreams(purpose hashring.Purpose, key string) []hashring.Node {
+	ring := p.holder.Ring()
+	if p.options.LoadFactor <= 1 {
+		replicas := p.options.Replicas
+		if replicas > ring.Size() {
+			replicas = ring.Size()
+		}
+		nodes, _ := ring.GetNodesForReplicasFor(purpose, key, replicas)
+		return nodes
+	}
+
+	nodes, _ := ring.GetNodesForReplicasFor(purpose, key, ring.Size())
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	limit := int(math.Ceil(p.options.LoadFactor * float64(p.total+1) / float64(len(nodes))))
+	first := 0
+	for i, node := range nodes {
+		if p.loads[node.String()] < limit {
+			first = i
+			break
+		}
+	}
+	p.mu.Unlock()
+
+	ordered := make([]hashring.Node, 0, p.options.Replicas)
+	for i := 0; i < len(nodes) && len(ordered) < p.options.Replicas; i++ {
+		ordered = append(ordered, nodes[(first+i)%len(nodes)])
+	}
+	return ordered
+}
+
+func (p *Proxy) acquire(node hashring.Node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.loads[node.String()]++
+	p.total++
+}
+
+func (p *Proxy) release(node hashring.Node) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.loads[node.String()]--
+	if p.loads[node.String()] == 0 {
+		delete(p.loads, node.String())
+	}
+	p.total--
+}
+
+func (p *Proxy) host(node hashring.Node) string {
+	if p.options.Host != nil {
+		return p.options.Host(node)
+	}
+	return node.String()
+}
+
+// UpstreamStatus describes an upstream in the responses of the admin handler.
+type UpstreamStatus struct {
+	Name     string `json:"name"`
+	Down     bool   `json:"down"`
+	InFlight int    `json:"in_flight"`
+}
+
+// Upstreams returns the nodes of the holder with their in-flight requests.
+func (p *Proxy) Upstreams() []UpstreamStatus {
+	ring := p.holder.Ring()
+	nodes := ring.Nodes()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]UpstreamStatus, 0, len(nodes))
+	for _, node := range nodes {
+		statuses = append(statuses, UpstreamStatus{
+			Name:     node.String(),
+			Down:     ring.IsDown(node),
+			InFlight: p.loads[node.String()],
+		})
+	}
+	return statuses
+}
+
+// AdminHandler returns a handler managing the upstreams at runtime:
+//
+//	GET                  lists the upstreams as JSON
+//	POST   ?node=host:port  adds an upstream
+//	DELETE ?node=host:port  removes an upstream
+//
+// It should only be served to trusted clients.
+func (p *Proxy) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("node")
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			if name == "" {
+				http.Error(w, "missing node parameter", http.StatusBadRequest)
+				return
+			}
+			p.holder.AddNode(p.options.NewNode(name))
+		case http.MethodDelete:
+			if name == "" {
+				http.Error(w, "missing node parameter", http.StatusBadRequest)
+				return
+			}
+			found := false
+			for _, node := range p.holder.Nodes() {
+				if node.String() == name {
+					p.holder.RemoveNode(node)
+					found = true
+				}
+			}
+			if !found {
+				http.Error(w, "unknown node "+name, http.StatusNotFound)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(p.Upstreams())
+	})
+}
@@ -0,0 +1,143 @@
+package hashhttp
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mugli/hashring"
+	"github.com/stretchr/testify/assert"
+)
+
+func proxyGet(t *testing.T, proxy http.Handler, key string) (int, string) {
+	req := httptest.NewRequest(http.MethodGet, "http://proxy/"+key, nil)
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestProxyRoutesAndFailsOver(t *testing.T) {
+	servers, ring := startBackends(t, 3)
+	holder := hashring.NewHolder(ring)
+	proxy := NewProxy(holder, ProxyOptions{Key: PathSegmentKey(0)})
+
+	replicas, _ := ring.GetNodesForReplicas("key", 3)
+	code, body := proxyGet(t, proxy, "key")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, replicas[0].String()+" ", body)
+
+	// down upstreams are skipped
+	holder.MarkDown(replicas[0])
+	_, body = proxyGet(t, proxy, "key")
+	assert.Equal(t, replicas[1].String()+" ", body)
+	holder.MarkUp(replicas[0])
+
+	// unreachable upstreams fail over to the next replica
+	for _, server := range servers {
+		if server.Listener.Addr().String() == replicas[0].String() {
+			server.Close()
+		}
+	}
+	_, body = proxyGet(t, proxy, "key")
+	assert.Equal(t, replicas[1].String()+" ", body)
+
+	code, _ = proxyGet(t, proxy, "")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestProxyBadGateway(t *testing.T) {
+	servers, ring := startBackends(t, 1)
+	servers[0].Close()
+	proxy := NewProxy(hashring.NewHolder(ring), ProxyOptions{Key: PathSegmentKey(0)})
+
+	code, _ := proxyGet(t, proxy, "key")
+	assert.Equal(t, http.StatusBadGateway, code)
+
+	proxy = NewProxy(hashring.NewHolder(hashring.New([]hashring.Node{})), ProxyOptions{Key: PathSegmentKey(0)})
+	code, _ = proxyGet(t, proxy, "key")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestProxyBoundedLoad(t *testing.T) {
+	release := make(chan struct{})
+	nodes := make([]hashring.Node, 0, 3)
+	for i := 0; i < 3; i++ {
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("block") != "" {
+				<-release
+			}
+			_, _ = io.WriteString(w, server.Listener.Addr().String())
+		}))
+		t.Cleanup(server.Close)
+		nodes = append(nodes, hashring.StringNode(server.Listener.Addr().String()))
+	}
+	ring := hashring.New(nodes)
+	proxy := NewProxy(hashring.NewHolder(ring), ProxyOptions{Key: PathSegmentKey(0), LoadFactor: 1.25})
+	replicas, _ := ring.GetNodesForReplicas("key", 3)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://proxy/key?block=1", nil))
+		assert.Equal(t, replicas[0].String(), rec.Body.String())
+	}()
+	assert.Eventually(t, func() bool {
+		for _, status := range proxy.Upstreams() {
+			if status.InFlight > 0 {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 5*time.Millisecond)
+
+	// the owner of the key is at its limit, the request spills over to the next node
+	_, body := proxyGet(t, proxy, "key")
+	assert.Equal(t, replicas[1].String(), body)
+
+	close(release)
+	<-done
+	_, body = proxyGet(t, proxy, "key")
+	assert.Equal(t, replicas[0].String(), body)
+}
+
+func TestProxyAdminHandler(t *testing.T) {
+	_, ring := startBackends(t, 2)
+	holder := hashring.NewHolder(ring)
+	admin := NewProxy(holder, ProxyOptions{Key: PathSegmentKey(0)}).AdminHandler()
+
+	do := func(method, target string) (int, []UpstreamStatus) {
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		var statuses []UpstreamStatus
+		if rec.Code == http.StatusOK {
+			assert.NoError(t, json.NewDecoder(rec.Body).Decode(&statuses))
+		}
+		return rec.Code, statuses
+	}
+
+	code, statuses := do(http.MethodGet, "/")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, statuses, 2)
+
+	code, statuses = do(http.MethodPost, "/?node=127.0.0.1:1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, statuses, 3)
+	assert.Equal(t, 3, holder.Ring().Size())
+
+	code, statuses = do(http.MethodDelete, "/?node=127.0.0.1:1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, statuses, 2)
+
+	code, _ = do(http.MethodDelete, "/?node=127.0.0.1:1")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = do(http.MethodPost, "/")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do(http.MethodPut, "/")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+}
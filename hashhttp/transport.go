@@ -0,0 +1,194 @@
+// Package hashhttp routes HTTP requests to the backend owning a key extracted from the request.
+package hashhttp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mugli/hashring"
+)
+
+// ErrNoBackend is returned when the ring has no node for the routing key.
+var ErrNoBackend = errors.New("hashhttp: no backend available")
+
+// KeyFunc extracts the routing key of a request.
+type KeyFunc func(r *http.Request) (string, error)
+
+// HeaderKey routes requests by the value of the header name. Requests without it are rejected.
+func HeaderKey(name string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		value := r.Header.Get(name)
+		if value == "" {
+			return "", fmt.Errorf("hashhttp: missing %s header", name)
+		}
+		return value, nil
+	}
+}
+
+// QueryKey routes requests by the value of the query parameter name. Requests without it are rejected.
+func QueryKey(name string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			return "", fmt.Errorf("hashhttp: missing %s query parameter", name)
+		}
+		return value, nil
+	}
+}
+
+// PathSegmentKey routes requests by the segment at index of their path, starting at 0.
+// For instance the key of /users/42/posts is 42 with index 1.
+func PathSegmentKey(index int) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if index < 0 || index >= len(segments) || segments[index] == "" {
+			return "", fmt.Errorf("hashhttp: path %s has no segment %d", r.URL.Path, index)
+		}
+		return segments[index], nil
+	}
+}
+
+// RingSource provides the current ring, *hashring.Holder implements it.
+type RingSource interface {
+	Ring() *hashring.HashRing
+}
+
+type staticRing struct {
+	ring *hashring.HashRing
+}
+
+func (s staticRing) Ring() *hashring.HashRing {
+	return s.ring
+}
+
+// Static is a RingSource always returning ring.
+func Static(ring *hashring.HashRing) RingSource {
+	return staticRing{ring: ring}
+}
+
+// Transport is an http.RoundTripper sending every request to the node owning its routing key.
+// The host of the request URL is replaced by the address of the node. When the node can't be reached,
+// the request is retried on the next replicas of the key.
+// Node states are honored: GET, HEAD and OPTIONS requests are routed like reads, the others like writes,
+// see RequestPurpose.
+//
+// Only failures to connect are retried, since the node can't have received the request: other errors,
+// like timeouts or connections reset mid-request, are returned as is so that non-idempotent requests
+// don't run twice. Responses are returned as is whatever their status code.
+// Requests with a body are retried only if their GetBody is set, which http.NewRequest does for common body types.
+type Transport struct {
+	Base     http.RoundTripper               // Base sends the rewritten requests, http.DefaultTransport if nil.
+	Ring     RingSource                      // Ring picks the backends.
+	Key      KeyFunc                         // Key extracts the routing key of the requests.
+	Replicas int                             // Replicas is the number of nodes tried per request, 2 by default.
+	Host     func(node hashring.Node) string // Host returns the host:port of a node, node.String() if nil.
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := t.Key(req)
+	if err != nil {
+		closeBody(req)
+		return nil, err
+	}
+	nodes := t.Nodes(RequestPurpose(req), key)
+	if len(nodes) == 0 {
+		closeBody(req)
+		return nil, ErrNoBackend
+	}
+
+	var lastErr error
+	for i, node := range nodes {
+		if i > 0 {
+			if req.Context().Err() != nil {
+				break
+			}
+			if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+				// the body is consumed and can't be sent again
+				break
+			}
+		}
+
+		attempt, err := t.rewrite(req, node, i > 0)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := t.base().RoundTrip(attempt)
+		if err == nil || !isDialError(err) {
+			return resp, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// isDialError reports whether err happened while connecting to a node, before the request was sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// closeBody closes the body of a request which isn't sent, as required from an http.RoundTripper.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+// Nodes returns the nodes a request with the routing key is sent to for purpose, in order.
+func (t *Transport) Nodes(purpose hashring.Purpose, key string) []hashring.Node {
+	ring := t.Ring.Ring()
+	replicas := t.Replicas
+	if replicas <= 0 {
+		replicas = 2
+	}
+	if replicas > ring.Size() {
+		replicas = ring.Size()
+	}
+	nodes, _ := ring.GetNodesForReplicasFor(purpose, key, replicas)
+	return nodes
+}
+
+// RequestPurpose returns hashring.ForRead for safe methods, GET, HEAD and OPTIONS, and hashring.ForWrite otherwise.
+func RequestPurpose(req *http.Request) hashring.Purpose {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return hashring.ForRead
+	default:
+		return hashring.ForWrite
+	}
+}
+
+// rewrite returns a copy of req sent to node. The body is obtained again from GetBody on retries.
+func (t *Transport) rewrite(req *http.Request, node hashring.Node, retry bool) (*http.Request, error) {
+	attempt := req.Clone(req.Context())
+	attempt.URL.Host = t.host(node)
+	if attempt.URL.Scheme == "" {
+		attempt.URL.Scheme = "http"
+	}
+	attempt.Host = ""
+	if retry && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("hashhttp: %w", err)
+		}
+		attempt.Body = body
+	}
+	return attempt, nil
+}
+
+func (t *Transport) host(node hashring.Node) string {
+	if t.Host != nil {
+		return t.Host(node)
+	}
+	return node.String()
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
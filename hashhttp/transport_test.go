@@ -0,0 +1,198 @@
+package hashhttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mugli/hashring"
+	"github.com/stretchr/testify/assert"
+)
+
+// startBackends starts servers answering with their own address and the request body.
+func startBackends(t *testing.T, n int) ([]*httptest.Server, *hashring.HashRing) {
+	servers := make([]*httptest.Server, 0, n)
+	nodes := make([]hashring.Node, 0, n)
+	for i := 0; i < n; i++ {
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, "%s %s", server.Listener.Addr().String(), body)
+		}))
+		t.Cleanup(server.Close)
+		servers = append(servers, server)
+		nodes = append(nodes, hashring.StringNode(server.Listener.Addr().String()))
+	}
+	return servers, hashring.New(nodes)
+}
+
+func get(t *testing.T, client *http.Client, target string, header string) string {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	assert.NoError(t, err)
+	req.Header.Set("X-Shard", header)
+	resp, err := client.Do(req)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestKeyFuncs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://shards/users/42/posts?tenant=acme", nil)
+	req.Header.Set("X-Shard", "s1")
+
+	key, err := HeaderKey("X-Shard")(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "s1", key)
+	key, err = QueryKey("tenant")(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", key)
+	key, err = PathSegmentKey(1)(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", key)
+
+	_, err = HeaderKey("X-Missing")(req)
+	assert.Error(t, err)
+	_, err = QueryKey("missing")(req)
+	assert.Error(t, err)
+	_, err = PathSegmentKey(3)(req)
+	assert.Error(t, err)
+}
+
+func TestTransportRoutesByKey(t *testing.T) {
+	_, ring := startBackends(t, 3)
+	client := &http.Client{Transport: &Transport{Ring: Static(ring), Key: HeaderKey("X-Shard")}}
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		owner, _ := ring.GetNode(key)
+		assert.Equal(t, owner.String()+" ", get(t, client, "http://shards/path", key))
+	}
+
+	_, err := client.Get("http://shards/path")
+	assert.Error(t, err, "requests without a routing key must be rejected")
+}
+
+func TestTransportHonorsNodeStates(t *testing.T) {
+	_, ring := startBackends(t, 3)
+	replicas, _ := ring.GetNodesForReplicas("key", 3)
+	joining := ring.SetNodeState(replicas[0], hashring.NodeJoining)
+	client := &http.Client{Transport: &Transport{Ring: Static(joining), Key: PathSegmentKey(0)}}
+
+	// joining backends receive writes but don't serve reads yet
+	assert.Equal(t, replicas[1].String()+" ", get(t, client, "http://shards/key", ""))
+	resp, err := client.Post("http://shards/key", "text/plain", strings.NewReader("payload"))
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, replicas[0].String()+" payload", string(body))
+	}
+
+	assert.Equal(t, hashring.ForRead, RequestPurpose(httptest.NewRequest(http.MethodHead, "/", nil)))
+	assert.Equal(t, hashring.ForWrite, RequestPurpose(httptest.NewRequest(http.MethodDelete, "/", nil)))
+}
+
+func TestTransportRetriesNextReplica(t *testing.T) {
+	servers, ring := startBackends(t, 3)
+	transport := &Transport{Ring: Static(ring), Key: PathSegmentKey(0)}
+	client := &http.Client{Transport: transport}
+
+	replicas, _ := ring.GetNodesForReplicas("key", 2)
+	for _, server := range servers {
+		if server.Listener.Addr().String() == replicas[0].String() {
+			server.Close()
+		}
+	}
+
+	resp, err := client.Post("http://shards/key", "text/plain", strings.NewReader("payload"))
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, replicas[1].String()+" payload", string(body))
+	}
+
+	transport.Replicas = 1
+	_, err = client.Get("http://shards/key")
+	assert.Error(t, err)
+}
+
+// failingTransport fails every request with err and records the hosts it was sent to.
+type failingTransport struct {
+	err   error
+	hosts []string
+}
+
+func (f *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.hosts = append(f.hosts, req.URL.Host)
+	return nil, f.err
+}
+
+func TestTransportOnlyRetriesDialErrors(t *testing.T) {
+	ring := hashring.New([]hashring.Node{hashring.StringNode("a"), hashring.StringNode("b")})
+
+	base := &failingTransport{err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	client := &http.Client{Transport: &Transport{Base: base, Ring: Static(ring), Key: PathSegmentKey(0)}}
+	_, err := client.Post("http://shards/key", "text/plain", strings.NewReader("payload"))
+	assert.Error(t, err)
+	assert.Len(t, base.hosts, 2, "dial errors are retried on the next replica")
+
+	// the request may have reached the node, it must not run twice
+	base = &failingTransport{err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}}
+	client = &http.Client{Transport: &Transport{Base: base, Ring: Static(ring), Key: PathSegmentKey(0)}}
+	_, err = client.Post("http://shards/key", "text/plain", strings.NewReader("payload"))
+	assert.Error(t, err)
+	assert.Len(t, base.hosts, 1)
+}
+
+// trackedBody records whether it's closed.
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestTransportClosesUnsentBodies(t *testing.T) {
+	transport := &Transport{Ring: Static(hashring.New([]hashring.Node{})), Key: HeaderKey("X-Shard")}
+
+	body := &trackedBody{Reader: strings.NewReader("payload")}
+	req, _ := http.NewRequest(http.MethodPost, "http://shards/", body)
+	_, err := transport.RoundTrip(req)
+	assert.Error(t, err)
+	assert.True(t, body.closed, "the body must be closed when the key is missing")
+
+	body = &trackedBody{Reader: strings.NewReader("payload")}
+	req, _ = http.NewRequest(http.MethodPost, "http://shards/", body)
+	req.Header.Set("X-Shard", "key")
+	_, err = transport.RoundTrip(req)
+	assert.ErrorIs(t, err, ErrNoBackend)
+	assert.True(t, body.closed, "the body must be closed when there's no backend")
+}
+
+func TestTransportFollowsHolder(t *testing.T) {
+	_, ring := startBackends(t, 2)
+	holder := hashring.NewHolder(hashring.New([]hashring.Node{}))
+	client := &http.Client{Transport: &Transport{Ring: holder, Key: QueryKey("k")}}
+
+	_, err := client.Get("http://shards/?k=a")
+	assert.ErrorIs(t, err, ErrNoBackend)
+
+	holder.Swap(ring)
+	owner, _ := ring.GetNode("a")
+	resp, err := client.Get("http://shards/?k=" + url.QueryEscape("a"))
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, owner.String()+" ", string(body))
+	}
+}
@@ -0,0 +1,18 @@
+module github.com/mugli/hashring/hashmemcache
+
+go 1.18
+
+require (
+	github.com/bradfitz/gomemcache v0.0.0-20260422231931-4d751bb6e37c
+	github.com/mugli/hashring v0.0.0-20261018221923-76bbeebdaab2
+	github.com/stretchr/testify v1.7.2
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// replace builds against the local checkout during development, it's ignored by the modules requiring hashmemcache.
+replace github.com/mugli/hashring => ../
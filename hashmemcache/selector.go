@@ -0,0 +1,126 @@
+// Package hashmemcache plugs a hashring into github.com/bradfitz/gomemcache, so that adding or removing
+// a memcache server only remaps the keys it owns, instead of almost all keys with the default modulo hashing.
+//
+//	selector := hashmemcache.NewSelector(hashring.NewHolder(hashring.New([]hashring.Node{})))
+//	err := selector.SetServers("10.0.0.1:11211", "10.0.0.2:11211")
+//	client := memcache.NewFromSelector(selector)
+package hashmemcache
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/mugli/hashring"
+)
+
+// Selector is a memcache.ServerSelector picking the server owning a key on the ring of a holder.
+// The servers can be changed at runtime with SetServers, or by any other update of the holder
+// such as a membership watcher, without recreating the client.
+type Selector struct {
+	holder *hashring.Holder
+
+	mu    sync.RWMutex
+	addrs map[string]net.Addr // addrs caches the resolved addresses by node name
+}
+
+var _ memcache.ServerSelector = (*Selector)(nil)
+
+// NewSelector creates a Selector using the nodes of holder as servers.
+// Nodes are named host:port, or are the path of a unix socket if they contain a /.
+func NewSelector(holder *hashring.Holder) *Selector {
+	return &Selector{
+		holder: holder,
+		addrs:  make(map[string]net.Addr),
+	}
+}
+
+// SetServers replaces the servers of the ring. Like memcache.ServerList.SetServers, it returns an error
+// if a server fails to resolve, in which case no change is made.
+func (s *Selector) SetServers(servers ...string) error {
+	addrs := make(map[string]net.Addr, len(servers))
+	nodes := make([]hashring.Node, 0, len(servers))
+	for _, server := range servers {
+		addr, err := resolve(server)
+		if err != nil {
+			return err
+		}
+		addrs[server] = addr
+		nodes = append(nodes, hashring.StringNode(server))
+	}
+
+	s.mu.Lock()
+	s.addrs = addrs
+	s.mu.Unlock()
+	s.holder.SetNodes(nodes)
+	return nil
+}
+
+// PickServer returns the address of the server owning key. Servers marked down are skipped.
+// Gets and sets must agree on the server, so both pick it like reads, see hashring.ForRead:
+// joining servers don't own keys until they are active, draining and leaving servers no longer do.
+func (s *Selector) PickServer(key string) (net.Addr, error) {
+	node, ok := s.holder.Ring().GetNodeFor(hashring.ForRead, key)
+	if !ok {
+		return nil, memcache.ErrNoServers
+	}
+	return s.addr(node)
+}
+
+// Each calls f with the address of every server, down ones included.
+func (s *Selector) Each(f func(net.Addr) error) error {
+	for _, node := range s.holder.Nodes() {
+		addr, err := s.addr(node)
+		if err != nil {
+			return err
+		}
+		if err := f(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addr returns the resolved address of node, resolving nodes added to the holder by other means on first use.
+func (s *Selector) addr(node hashring.Node) (net.Addr, error) {
+	name := node.String()
+	s.mu.RLock()
+	addr, ok := s.addrs[name]
+	s.mu.RUnlock()
+	if ok {
+		return addr, nil
+	}
+
+	addr, err := resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.addrs[name] = addr
+	s.mu.Unlock()
+	return addr, nil
+}
+
+func resolve(server string) (net.Addr, error) {
+	if strings.Contains(server, "/") {
+		addr, err := net.ResolveUnixAddr("unix", server)
+		if err != nil {
+			return nil, err
+		}
+		return staticAddr{network: addr.Network(), str: addr.String()}, nil
+	}
+	addr, err := net.ResolveTCPAddr("tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	return staticAddr{network: addr.Network(), str: addr.String()}, nil
+}
+
+// staticAddr caches the Network() and String() values of a net.Addr, like gomemcache does.
+type staticAddr struct {
+	network, str string
+}
+
+func (a staticAddr) Network() string { return a.network }
+func (a staticAddr) String() string  { return a.str }
@@ -0,0 +1,93 @@
+package hashmemcache
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/mugli/hashring"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectorPickServer(t *testing.T) {
+	holder := hashring.NewHolder(hashring.New([]hashring.Node{}))
+	selector := NewSelector(holder)
+
+	_, err := selector.PickServer("key")
+	assert.ErrorIs(t, err, memcache.ErrNoServers)
+
+	servers := []string{"127.0.0.1:11211", "127.0.0.1:11212", "127.0.0.1:11213"}
+	assert.NoError(t, selector.SetServers(servers...))
+
+	ring := hashring.New([]hashring.Node{hashring.StringNode(servers[0]), hashring.StringNode(servers[1]), hashring.StringNode(servers[2])})
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		owner, _ := ring.GetNode(key)
+		addr, err := selector.PickServer(key)
+		assert.NoError(t, err)
+		assert.Equal(t, "tcp", addr.Network())
+		assert.Equal(t, owner.String(), addr.String())
+	}
+
+	// only the keys of the removed server move
+	assert.NoError(t, selector.SetServers(servers[:2]...))
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		owner, _ := ring.GetNode(key)
+		addr, _ := selector.PickServer(key)
+		if owner.String() != servers[2] {
+			assert.Equal(t, owner.String(), addr.String())
+		}
+	}
+
+	assert.Error(t, selector.SetServers("127.0.0.1:11211", "127.0.0.1:port"))
+	assert.Equal(t, 2, holder.Ring().Size(), "a failed SetServers must not change the ring")
+}
+
+func TestSelectorHonorsNodeStates(t *testing.T) {
+	holder := hashring.NewHolder(hashring.New([]hashring.Node{}))
+	selector := NewSelector(holder)
+	assert.NoError(t, selector.SetServers("127.0.0.1:11211", "127.0.0.1:11212"))
+
+	owner, _ := holder.Ring().GetNode("key")
+	holder.SetNodeState(owner, hashring.NodeLeaving)
+	addr, err := selector.PickServer("key")
+	assert.NoError(t, err)
+	assert.NotEqual(t, owner.String(), addr.String())
+
+	holder.SetNodeState(owner, hashring.NodeJoining)
+	addr, _ = selector.PickServer("key")
+	assert.NotEqual(t, owner.String(), addr.String())
+
+	holder.SetNodeState(owner, hashring.NodeActive)
+	addr, _ = selector.PickServer("key")
+	assert.Equal(t, owner.String(), addr.String())
+}
+
+func TestSelectorFollowsHolder(t *testing.T) {
+	holder := hashring.NewHolder(hashring.New([]hashring.Node{}))
+	selector := NewSelector(holder)
+
+	holder.AddNode(hashring.StringNode("/tmp/memcached.sock"))
+	addr, err := selector.PickServer("key")
+	assert.NoError(t, err)
+	assert.Equal(t, "unix", addr.Network())
+
+	holder.AddNode(hashring.StringNode("127.0.0.1:11211"))
+	addrs := make([]string, 0)
+	assert.NoError(t, selector.Each(func(addr net.Addr) error {
+		addrs = append(addrs, addr.String())
+		return nil
+	}))
+	assert.Equal(t, []string{"/tmp/memcached.sock", "127.0.0.1:11211"}, addrs)
+
+	stop := errors.New("stop")
+	assert.ErrorIs(t, selector.Each(func(net.Addr) error { return stop }), stop)
+}
+
+func TestSelectorWithClient(t *testing.T) {
+	selector := NewSelector(hashring.NewHolder(hashring.New([]hashring.Node{})))
+	client := memcache.NewFromSelector(selector)
+
+	_, err := client.Get("key")
+	assert.ErrorIs(t, err, memcache.ErrNoServers)
+}
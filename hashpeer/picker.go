@@ -0,0 +1,70 @@
+// Package hashpeer picks which peer of a cluster owns a key, the way groupcache does, recognizing the local
+// peer so that keys it owns are served without a network hop.
+package hashpeer
+
+import (
+	"github.com/mugli/hashring"
+)
+
+// Picker picks the peers owning keys on the ring of a holder. Peers marked down in the holder,
+// for instance by a health.Monitor, are skipped, so their keys fail over to the next replica.
+// Node states are honored like for reads, see hashring.ForRead: joining peers don't own keys yet,
+// draining peers only when no active replica is left, leaving peers never.
+type Picker struct {
+	holder *hashring.Holder
+	self   string
+}
+
+// NewPicker creates a Picker. self is the name of the local peer, as returned by the String() of its node.
+func NewPicker(holder *hashring.Holder, self string) *Picker {
+	return &Picker{
+		holder: holder,
+		self:   self,
+	}
+}
+
+// Self returns the name of the local peer.
+func (p *Picker) Self() string {
+	return p.self
+}
+
+// PickPeer returns the peer owning key. ok is false when key is owned by the local peer or when no peer
+// is available, the caller is then expected to serve key itself.
+func (p *Picker) PickPeer(key string) (peer hashring.Node, ok bool) {
+	node, ok := p.holder.Ring().GetNodeFor(hashring.ForRead, key)
+	if !ok || node.String() == p.self {
+		return nil, false
+	}
+	return node, true
+}
+
+// IsLocal reports whether key is owned by the local peer, or no peer is available.
+func (p *Picker) IsLocal(key string) bool {
+	_, ok := p.PickPeer(key)
+	return !ok
+}
+
+// PickPeers returns the remote peers among the n replicas of key, in replica order.
+// local reports whether the local peer is one of the replicas, it's omitted from peers.
+// Less than n replicas are considered when the ring has less than n peers up and serving reads.
+func (p *Picker) PickPeers(key string, n int) (peers []hashring.Node, local bool) {
+	ring := p.holder.Ring()
+	if n > ring.Size() {
+		n = ring.Size()
+	}
+	nodes, _ := ring.GetNodesForReplicasFor(hashring.ForRead, key, n)
+	if len(nodes) > n {
+		// draining fallbacks beyond the n replicas
+		nodes = nodes[:n]
+	}
+
+	peers = make([]hashring.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node.String() == p.self {
+			local = true
+			continue
+		}
+		peers = append(peers, node)
+	}
+	return peers, local
+}
@@ -0,0 +1,96 @@
+package hashpeer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mugli/hashring"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHolder() *hashring.Holder {
+	return hashring.NewHolder(hashring.New([]hashring.Node{hashring.StringNode("a"), hashring.StringNode("b"), hashring.StringNode("c")}))
+}
+
+func TestPickPeer(t *testing.T) {
+	holder := newHolder()
+	ring := holder.Ring()
+
+	pickers := map[string]*Picker{}
+	for _, name := range []string{"a", "b", "c"} {
+		pickers[name] = NewPicker(holder, name)
+	}
+
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		owner, _ := ring.GetNode(key)
+		for name, picker := range pickers {
+			remote, ok := picker.PickPeer(key)
+			if name == owner.String() {
+				assert.False(t, ok)
+				assert.True(t, picker.IsLocal(key))
+			} else {
+				assert.True(t, ok)
+				assert.Equal(t, owner, remote)
+				assert.False(t, picker.IsLocal(key))
+			}
+		}
+	}
+
+	empty := NewPicker(hashring.NewHolder(hashring.New([]hashring.Node{})), "a")
+	_, ok := empty.PickPeer("key")
+	assert.False(t, ok)
+}
+
+func TestPickPeerSkipsDownPeers(t *testing.T) {
+	holder := newHolder()
+	replicas, _ := holder.Ring().GetNodesForReplicas("key", 2)
+	picker := NewPicker(holder, replicas[1].String())
+
+	remote, ok := picker.PickPeer("key")
+	assert.True(t, ok)
+	assert.Equal(t, replicas[0], remote)
+
+	holder.MarkDown(replicas[0])
+	assert.True(t, picker.IsLocal("key"), "the next replica takes over the keys of a down peer")
+}
+
+func TestPickPeers(t *testing.T) {
+	holder := newHolder()
+	replicas, _ := holder.Ring().GetNodesForReplicas("key", 3)
+
+	peers, local := NewPicker(holder, replicas[1].String()).PickPeers("key", 2)
+	assert.True(t, local)
+	assert.Equal(t, []hashring.Node{replicas[0]}, peers)
+
+	peers, local = NewPicker(holder, replicas[2].String()).PickPeers("key", 2)
+	assert.False(t, local)
+	assert.Equal(t, replicas[:2], peers)
+
+	peers, local = NewPicker(holder, "d").PickPeers("key", 5)
+	assert.False(t, local)
+	assert.Equal(t, replicas, peers)
+}
+
+func TestPickPeerHonorsNodeStates(t *testing.T) {
+	holder := newHolder()
+	replicas, _ := holder.Ring().GetNodesForReplicas("key", 3)
+	picker := NewPicker(holder, "d")
+
+	holder.SetNodeState(replicas[0], hashring.NodeLeaving)
+	remote, ok := picker.PickPeer("key")
+	assert.True(t, ok)
+	assert.Equal(t, replicas[1], remote, "leaving peers don't own keys")
+	peers, _ := picker.PickPeers("key", 2)
+	assert.Equal(t, replicas[1:], peers)
+
+	holder.SetNodeState(replicas[0], hashring.NodeJoining)
+	remote, _ = picker.PickPeer("key")
+	assert.Equal(t, replicas[1], remote, "joining peers don't own keys yet")
+
+	holder.SetNodeState(replicas[0], hashring.NodeActive)
+	holder.SetNodeState(replicas[1], hashring.NodeDraining)
+	holder.SetNodeState(replicas[2], hashring.NodeDraining)
+	peers, _ = picker.PickPeers("key", 2)
+	assert.Equal(t, replicas[:2], peers, "draining peers are fallbacks")
+}
@@ -0,0 +1,20 @@
+module github.com/mugli/hashring/hashredis
+
+go 1.18
+
+require (
+	github.com/mugli/hashring v0.0.0-20261018221923-76bbeebdaab2
+	github.com/redis/go-redis/v9 v9.7.3
+	github.com/stretchr/testify v1.7.2
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+// replace builds against the local checkout during development, it's ignored by the modules requiring hashredis.
+replace github.com/mugli/hashring => ../
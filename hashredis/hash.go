@@ -0,0 +1,60 @@
+// Package hashredis plugs a hashring into the Ring client of github.com/redis/go-redis, in place of
+// its default rendezvous hashing.
+//
+//	ring := redis.NewRing(&redis.RingOptions{
+//		Addrs:             map[string]string{"shard1": "10.0.0.1:6379", "shard2": "10.0.0.2:6379"},
+//		NewConsistentHash: hashredis.NewConsistentHash,
+//	})
+//
+// The Ring client applies Redis hash tags before hashing keys, see hashring.HashTag to do the same for other lookups.
+package hashredis
+
+import (
+	"fmt"
+
+	"github.com/mugli/hashring"
+	"github.com/redis/go-redis/v9"
+)
+
+// ConsistentHash is a redis.ConsistentHash backed by a hashring of shard names.
+type ConsistentHash struct {
+	ring *hashring.HashRing
+}
+
+var _ redis.ConsistentHash = (*ConsistentHash)(nil)
+
+// NewConsistentHash creates a ConsistentHash of shards with the default hash function.
+// It has the signature of redis.RingOptions.NewConsistentHash, the Ring client calls it with the live shards
+// every time a shard goes down or up.
+func NewConsistentHash(shards []string) redis.ConsistentHash {
+	return &ConsistentHash{ring: hashring.New(shardNodes(shards))}
+}
+
+// WithHash returns a redis.RingOptions.NewConsistentHash function using the hash function registered as name,
+// see hashring.RegisterHash.
+func WithHash(name string) (func(shards []string) redis.ConsistentHash, error) {
+	if _, ok := hashring.LookupHash(name); !ok {
+		return nil, fmt.Errorf("hashredis: hash function %q is not registered", name)
+	}
+	return func(shards []string) redis.ConsistentHash {
+		ring, _ := hashring.NewWithHashName(shardNodes(shards), name)
+		return &ConsistentHash{ring: ring}
+	}, nil
+}
+
+func shardNodes(shards []string) []hashring.Node {
+	nodes := make([]hashring.Node, 0, len(shards))
+	for _, name := range shards {
+		nodes = append(nodes, hashring.StringNode(name))
+	}
+	return nodes
+}
+
+// Get returns the name of the shard owning key, or an empty string if there's no shard.
+func (c *ConsistentHash) Get(key string) string {
+	node, ok := c.ring.GetNode(key)
+	if !ok {
+		return ""
+	}
+	return node.String()
+}
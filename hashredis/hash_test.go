@@ -0,0 +1,45 @@
+package hashredis
+
+import (
+	"testing"
+
+	"github.com/mugli/hashring"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsistentHash(t *testing.T) {
+	shards := []string{"shard1", "shard2", "shard3"}
+	hash := NewConsistentHash(shards)
+
+	ring := hashring.New([]hashring.Node{hashring.StringNode("shard1"), hashring.StringNode("shard2"), hashring.StringNode("shard3")})
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		owner, _ := ring.GetNode(key)
+		assert.Equal(t, owner.String(), hash.Get(key))
+	}
+
+	// hash tags co-locate related keys
+	assert.Equal(t, hash.Get(hashring.HashTag("{user:42}:profile")), hash.Get(hashring.HashTag("{user:42}:sessions")))
+
+	assert.Equal(t, "", NewConsistentHash([]string{}).Get("a"))
+}
+
+func TestWithHash(t *testing.T) {
+	newHash, err := WithHash("sha256")
+	if assert.NoError(t, err) {
+		ring, _ := hashring.NewWithHashName([]hashring.Node{hashring.StringNode("shard1"), hashring.StringNode("shard2")}, "sha256")
+		owner, _ := ring.GetNode("key")
+		assert.Equal(t, owner.String(), newHash([]string{"shard1", "shard2"}).Get("key"))
+	}
+
+	_, err = WithHash("crc")
+	assert.Error(t, err)
+}
+
+func TestRingOptions(t *testing.T) {
+	client := redis.NewRing(&redis.RingOptions{
+		Addrs:             map[string]string{"shard1": "127.0.0.1:1"},
+		NewConsistentHash: NewConsistentHash,
+	})
+	assert.NoError(t, client.Close())
+}
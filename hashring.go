@@ -4,6 +4,7 @@ import (
 	"crypto/md5"
 	"fmt"
 	"sort"
+	"strconv"
 	"sync"
 )
 
@@ -12,34 +13,116 @@ type Node interface {
 	String() string
 }
 
+// StringNode is a Node made of its name only.
+type StringNode string
+
+func (n StringNode) String() string {
+	return string(n)
+}
+
 // HashRing is a consistent hash ring
 type HashRing struct {
-	nodeHashMap map[HashKey]Node // nodeHashMap is used to get a Node from its hashKey and return it in the GetNode like functions.
-	sortedKeys  []HashKey        // sortedKeys stores all hashed and sorted values of nodes, and ultimately used as the hashring
-	nodes       []Node           // nodes are members in consistent hash ring. this slice is kept sorted to perform binary search. nodes list is used to prevent duplicates for adding to the ring.
-	hashFunc    HashFunc         // hashFunc returns a comparable HashKey
-	mu          sync.RWMutex
+	nodeHashMap  map[HashKey]Node // nodeHashMap is used to get a Node from its hashKey and return it in the GetNode like functions.
+	sortedKeys   []HashKey        // sortedKeys stores all hashed and sorted values of nodes, and ultimately used as the hashring
+	nodes        []Node           // nodes are members in consistent hash ring. this slice is kept sorted to perform binary search. nodes list is used to prevent duplicates for adding to the ring.
+	hashFunc     HashFunc         // hashFunc returns a comparable HashKey
+	hashName     string           // hashName is the name hashFunc is registered with, empty if unknown
+	virtualNodes int              // virtualNodes is the number of tokens placed on the ring for every node
+
+	keyExtractor     KeyExtractor // keyExtractor derives the part of keys that is hashed, keys are hashed as is if nil
+	keyExtractorName string       // keyExtractorName identifies keyExtractor in summaries
+
+	fingerprint     uint64 // fingerprint caches the result of Fingerprint()
+	fingerprintOnce sync.Once
+
+	epoch             uint64 // epoch is incremented every time a ring is derived from another one
+	parentEpoch       uint64 // parentEpoch is the epoch of the ring this one was derived from, 0 if none
+	parentFingerprint uint64 // parentFingerprint is the fingerprint of the ring this one was derived from
+
+	states map[string]NodeState // states holds the lifecycle state of nodes by their String(), nodes missing from it are active
+	down   map[string]bool      // down holds the nodes marked down by their String(), it's the only state changed in place
+
+	mu sync.RWMutex
 }
 
 func New(nodes []Node) *HashRing {
-	return NewWithHash(nodes, defaultHashFunc)
+	return newHashRing(nodes, defaultHashFunc, defaultHashName, 1)
 }
 
 func NewWithHash(nodes []Node, hashFunc HashFunc) *HashRing {
+	return newHashRing(nodes, hashFunc, "", 1)
+}
+
+// NewWithHashName creates a hashring using the HashFunc registered under name with RegisterHash.
+// Unlike NewWithHash, the ring knows which hash function it uses and can be saved in a Snapshot.
+func NewWithHashName(nodes []Node, name string) (*HashRing, error) {
+	hashFunc, ok := LookupHash(name)
+	if !ok {
+		return nil, fmt.Errorf("hash function %q is not registered", name)
+	}
+	return newHashRing(nodes, hashFunc, name, 1), nil
+}
+
+func newHashRing(nodes []Node, hashFunc HashFunc, hashName string, virtualNodes int) *HashRing {
 	if nodes == nil {
 		panic("nodes cannot be nil")
 	}
+	if virtualNodes < 1 {
+		panic("virtual nodes must be at least 1")
+	}
 
 	hashRing := &HashRing{
-		nodeHashMap: make(map[HashKey]Node),
-		sortedKeys:  make([]HashKey, 0),
-		nodes:       nodes,
-		hashFunc:    hashFunc,
+		nodeHashMap:  make(map[HashKey]Node),
+		sortedKeys:   make([]HashKey, 0),
+		nodes:        nodes,
+		hashFunc:     hashFunc,
+		hashName:     hashName,
+		virtualNodes: virtualNodes,
+		epoch:        1,
 	}
 	hashRing.generateCircle()
 	return hashRing
 }
 
+// derive creates a new hashring from the given nodes, keeping the configuration of h.
+// The new hashring is one epoch ahead of h and references h as its parent.
+// derive requires Lock() or RLock(), make sure the caller is doing it
+func (h *HashRing) derive(nodes []Node) *HashRing {
+	hashRing := h.configure(nodes, h.virtualNodes)
+	hashRing.epoch = h.epoch + 1
+	hashRing.parentEpoch = h.epoch
+	hashRing.parentFingerprint = h.getFingerprint()
+	return hashRing
+}
+
+// configure creates a new hashring from the given nodes with virtualNodes tokens per node,
+// keeping the rest of the configuration, the node states and marks of h.
+// Unlike derive, the new hashring has the epoch and parent of h.
+// configure requires Lock() or RLock(), make sure the caller is doing it
+func (h *HashRing) configure(nodes []Node, virtualNodes int) *HashRing {
+	hashRing := newHashRing(nodes, h.hashFunc, h.hashName, virtualNodes)
+	hashRing.epoch = h.epoch
+	hashRing.parentEpoch = h.parentEpoch
+	hashRing.parentFingerprint = h.parentFingerprint
+	hashRing.keyExtractor = h.keyExtractor
+	hashRing.keyExtractorName = h.keyExtractorName
+	for _, node := range hashRing.nodes {
+		if state, ok := h.states[node.String()]; ok {
+			if hashRing.states == nil {
+				hashRing.states = make(map[string]NodeState)
+			}
+			hashRing.states[node.String()] = state
+		}
+		if h.down[node.String()] {
+			if hashRing.down == nil {
+				hashRing.down = make(map[string]bool)
+			}
+			hashRing.down[node.String()] = true
+		}
+	}
+	return hashRing
+}
+
 // ensureStateReset cleans computed sortedKeys and nodeHashMap before generateCircle execution
 func (h *HashRing) ensureStateReset() {
 	if len(h.sortedKeys) > 0 || len(h.nodeHashMap) > 0 {
@@ -59,10 +142,11 @@ func (h *HashRing) generateCircle() {
 	})
 
 	for _, node := range h.nodes {
-		nodeKey := node.String() + "-0" // "-0" is leftover from the weight feature that got removed. it's still here to make test assertions happy.
-		hashKey := h.hashFunc([]byte(nodeKey))
-		h.nodeHashMap[hashKey] = node
-		h.sortedKeys = append(h.sortedKeys, hashKey)
+		for i := 0; i < h.virtualNodes; i++ {
+			hashKey := h.hashFunc([]byte(virtualNodeKey(node, i)))
+			h.nodeHashMap[hashKey] = node
+			h.sortedKeys = append(h.sortedKeys, hashKey)
+		}
 	}
 
 	sort.SliceStable(h.sortedKeys, func(i, j int) bool {
@@ -70,13 +154,36 @@ func (h *HashRing) generateCircle() {
 	})
 }
 
+// virtualNodeKey returns what is hashed to place the i-th token of node on the ring.
+// A ring with a single virtual node hashes node-0, like the weight feature this fork removed did.
+func virtualNodeKey(node Node, i int) string {
+	return node.String() + "-" + strconv.Itoa(i)
+}
+
+// WithVirtualNodes returns a ring placing count tokens per node instead of one, to spread the keyspace
+// more evenly over the nodes at the cost of memory and lookup time. Ownership tells how even it is.
+// The number of virtual nodes is configuration rather than a membership change: the ring keeps the epoch
+// of h, and the rings derived from it keep the number of virtual nodes. It panics if count is less than 1.
+func (h *HashRing) WithVirtualNodes(count int) *HashRing {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	nodes := make([]Node, len(h.nodes))
+	copy(nodes, h.nodes)
+	return h.configure(nodes, count)
+}
+
+// VirtualNodes returns the number of tokens placed on the ring for every node, 1 unless set with WithVirtualNodes.
+func (h *HashRing) VirtualNodes() int {
+	return h.virtualNodes
+}
+
 // AddNode adds a node and generates a new hashring
 func (h *HashRing) AddNode(node Node) *HashRing {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	pos := sort.Search(len(h.nodes), func(i int) bool { return h.nodes[i].String() >= node.String() })
-	if pos < len(h.nodes) && h.nodes[pos].String() == node.String() {
+	if h.hasNode(node) {
 		// node is already present, just return
 		return h
 	}
@@ -85,14 +192,7 @@ func (h *HashRing) AddNode(node Node) *HashRing {
 	copy(nodes, h.nodes)
 	nodes = append(nodes, node)
 
-	hashRing := &HashRing{
-		nodeHashMap: make(map[HashKey]Node),
-		sortedKeys:  make([]HashKey, 0),
-		nodes:       nodes,
-		hashFunc:    h.hashFunc,
-	}
-	hashRing.generateCircle()
-	return hashRing
+	return h.derive(nodes)
 }
 
 // AddNode removes a node and generates a new hashring
@@ -101,8 +201,7 @@ func (h *HashRing) RemoveNode(node Node) *HashRing {
 	defer h.mu.Unlock()
 
 	/* if node isn't exist in hashring, don't refresh hashring */
-	pos := sort.Search(len(h.nodes), func(i int) bool { return h.nodes[i].String() >= node.String() })
-	if !(pos < len(h.nodes) && h.nodes[pos].String() == node.String()) {
+	if !h.hasNode(node) {
 		// node is not present, just return
 		return h
 	}
@@ -114,16 +213,52 @@ func (h *HashRing) RemoveNode(node Node) *HashRing {
 		}
 	}
 
-	hashRing := &HashRing{
-		nodeHashMap: make(map[HashKey]Node),
-		sortedKeys:  make([]HashKey, 0),
-		nodes:       nodes,
-		hashFunc:    h.hashFunc,
+	return h.derive(nodes)
+}
+
+// Update adds and removes several nodes at once and generates a single new hashring,
+// one epoch ahead of h. Nodes are matched by their String() representation.
+// h is returned as is if nothing changes.
+func (h *HashRing) Update(add []Node, remove []Node) *HashRing {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	removed := make(map[string]bool, len(remove))
+	for _, node := range remove {
+		if h.hasNode(node) {
+			removed[node.String()] = true
+		}
 	}
-	hashRing.generateCircle()
-	return hashRing
+
+	nodes := make([]Node, 0, len(h.nodes)+len(add))
+	for _, node := range h.nodes {
+		if !removed[node.String()] {
+			nodes = append(nodes, node)
+		}
+	}
+
+	added := make(map[string]bool, len(add))
+	for _, node := range add {
+		if added[node.String()] || (h.hasNode(node) && !removed[node.String()]) {
+			continue
+		}
+		added[node.String()] = true
+		nodes = append(nodes, node)
+	}
+
+	if len(removed) == 0 && len(added) == 0 {
+		return h
+	}
+	return h.derive(nodes)
 }
 
+// hasNode requires RLock(), make sure the caller is doing it
+func (h *HashRing) hasNode(node Node) bool {
+	pos := sort.Search(len(h.nodes), func(i int) bool { return h.nodes[i].String() >= node.String() })
+	return pos < len(h.nodes) && h.nodes[pos].String() == node.String()
+}
+
+// GetNode returns the node owning stringKey. Node states are ignored, see GetNodeFor.
 func (h *HashRing) GetNode(stringKey string) (node Node, ok bool) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -132,6 +267,13 @@ func (h *HashRing) GetNode(stringKey string) (node Node, ok bool) {
 	if !ok {
 		return nil, false
 	}
+	if len(h.down) > 0 {
+		nodes := h.getUpNodesFromPos(pos, 1)
+		if len(nodes) == 0 {
+			return nil, false
+		}
+		return nodes[0], true
+	}
 	return h.nodeHashMap[h.sortedKeys[pos]], true
 }
 
@@ -141,21 +283,25 @@ func (h *HashRing) getNodePos(stringKey string) (pos int, ok bool) {
 		return 0, false
 	}
 
-	key := h.GenKey(stringKey)
+	return h.getHashKeyPos(h.GenKey(stringKey)), true
+}
 
+// getHashKeyPos returns the position in sortedKeys of the node that owns the given HashKey.
+// getHashKeyPos requires RLock() and a non-empty ring, make sure the caller is doing it
+func (h *HashRing) getHashKeyPos(key HashKey) int {
 	sortedKeys := h.sortedKeys
-	pos = sort.Search(len(sortedKeys), func(i int) bool { return key.Less(sortedKeys[i]) })
+	pos := sort.Search(len(sortedKeys), func(i int) bool { return key.Less(sortedKeys[i]) })
 
 	if pos == len(sortedKeys) {
 		// Wrap the search, should return First node
-		return 0, true
-	} else {
-		return pos, true
+		return 0
 	}
+	return pos
 }
 
 // GetNodesForReplicas iterates over the hash ring and returns a list of nodes to fulfill replication requirements.
 // You can use this list of servers to store your key.
+// Node states are ignored, see GetNodesForReplicasFor.
 func (h *HashRing) GetNodesForReplicas(stringKey string, numberOfReplicas int) (nodes []Node, ok bool) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -169,6 +315,13 @@ func (h *HashRing) GetNodesForReplicas(stringKey string, numberOfReplicas int) (
 		return nil, false
 	}
 
+	resultSlice := h.getUpNodesFromPos(pos, numberOfReplicas)
+	return resultSlice, len(resultSlice) == numberOfReplicas
+}
+
+// getNodesFromPos walks the ring clockwise starting at pos and collects up to numberOfReplicas distinct nodes.
+// getNodesFromPos requires RLock(), make sure the caller is doing it
+func (h *HashRing) getNodesFromPos(pos int, numberOfReplicas int) []Node {
 	returnedValues := make(map[Node]bool, numberOfReplicas)
 	resultSlice := make([]Node, 0, numberOfReplicas)
 
@@ -184,10 +337,14 @@ func (h *HashRing) GetNodesForReplicas(stringKey string, numberOfReplicas int) (
 		}
 	}
 
-	return resultSlice, len(resultSlice) == numberOfReplicas
+	return resultSlice
 }
 
+// GenKey returns the HashKey of key, after applying the KeyExtractor of the ring if any.
 func (h *HashRing) GenKey(key string) HashKey {
+	if h.keyExtractor != nil {
+		key = h.keyExtractor(key)
+	}
 	return h.hashFunc([]byte(key))
 }
 
@@ -195,10 +352,57 @@ func (h *HashRing) Size() int {
 	return len(h.nodes)
 }
 
+// Epoch returns the version of the ring. Rings created by New* start at epoch 1,
+// every ring produced by AddNode, RemoveNode or Update is one epoch ahead of its parent.
+func (h *HashRing) Epoch() uint64 {
+	return h.epoch
+}
+
+// Parent returns the epoch and fingerprint of the ring h was derived from.
+// ok is false for rings created by New*, which have no parent.
+func (h *HashRing) Parent() (epoch uint64, fingerprint uint64, ok bool) {
+	return h.parentEpoch, h.parentFingerprint, h.parentEpoch != 0
+}
+
+// HashName returns the name of the hash function used by the ring, see RegisterHash.
+// It's empty for rings created with NewWithHash.
+func (h *HashRing) HashName() string {
+	return h.hashName
+}
+
+// Nodes returns the nodes of the ring without duplicates, sorted by their String() representation.
+func (h *HashRing) Nodes() []Node {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.getUniqueNodes()
+}
+
+// getUniqueNodes requires RLock(), make sure the caller is doing it
+func (h *HashRing) getUniqueNodes() []Node {
+	nodes := make([]Node, 0, len(h.nodes))
+	for _, node := range h.nodes {
+		if len(nodes) > 0 && nodes[len(nodes)-1].String() == node.String() {
+			// duplicate node, h.nodes is sorted
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
+
 type HashKey interface {
 	Less(other HashKey) bool
 }
 
+// PositionedHashKey is an optional extension of HashKey for keys that can report
+// where they are located on the ring as a fraction in [0, 1).
+// It's used to measure how much of the keyspace a Range covers.
+type PositionedHashKey interface {
+	HashKey
+	Position() float64
+}
+
 type HashFunc func([]byte) HashKey
 
 var defaultHashFunc = func() HashFunc {
@@ -442,3 +442,47 @@ func TestAddRemoveNode(t *testing.T) {
 	expectNodesABC(t, "TestAddRemoveNode_6_", ring)
 	expectNodeRangesABC(t, "", ring)
 }
+
+func TestVirtualNodes(t *testing.T) {
+	ring := New(generateNodes(5))
+	virtual := ring.WithVirtualNodes(64)
+
+	assert.Equal(t, 1, ring.VirtualNodes())
+	assert.Equal(t, 64, virtual.VirtualNodes())
+	assert.Equal(t, ring.Epoch(), virtual.Epoch())
+	assert.Equal(t, 5, virtual.Size())
+	assert.Len(t, virtual.Nodes(), 5)
+
+	replicas, ok := virtual.GetNodesForReplicas("key", 5)
+	assert.True(t, ok)
+	assert.ElementsMatch(t, generateNodes(5), replicas)
+
+	// more tokens spread the keyspace more evenly
+	assert.Less(t, virtual.Ownership(1).Primary.MaxMeanRatio, ring.Ownership(1).Primary.MaxMeanRatio)
+
+	const samples = 20000
+	counts := map[string]int{}
+	for i := 0; i < samples; i++ {
+		node, _ := virtual.GetNode(fmt.Sprintf("key%d", i))
+		counts[node.String()]++
+	}
+	for _, node := range virtual.Ownership(1).Nodes {
+		assert.InDelta(t, node.Primary, float64(counts[node.Node.String()])/samples, 0.02, node.Node.String())
+	}
+
+	// derived rings keep the number of virtual nodes
+	added := virtual.AddNode(myNode("005"))
+	assert.Equal(t, 64, added.VirtualNodes())
+	assert.Equal(t, virtual.Epoch()+1, added.Epoch())
+
+	// a single virtual node is the default ring
+	single := virtual.WithVirtualNodes(1)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		expected, _ := ring.GetNode(key)
+		node, _ := single.GetNode(key)
+		assert.Equal(t, expected, node, key)
+	}
+
+	assert.Panics(t, func() { ring.WithVirtualNodes(0) })
+}
@@ -0,0 +1,20 @@
+package hashring
+
+import "strings"
+
+// HashTag returns the part of key that should be hashed according to Redis Cluster hash tags:
+// the content of the first {...} section, if it's not empty. Keys sharing a hash tag are owned by the same node,
+// for instance {user:42}:profile and {user:42}:sessions are both hashed as user:42.
+// Keys without a hash tag are returned as is.
+func HashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		// no closing brace, or an empty {} section
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
@@ -0,0 +1,29 @@
+package hashring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashTag(t *testing.T) {
+	tests := map[string]string{
+		"{user:42}:profile": "user:42",
+		"profile:{user:42}": "user:42",
+		"{user:42}:{other}": "user:42",
+		"foo{}{bar}":        "foo{}{bar}",
+		"foo{{bar}}":        "{bar",
+		"foo{bar":           "foo{bar",
+		"foo}bar{":          "foo}bar{",
+		"no tag":            "no tag",
+		"":                  "",
+	}
+	for key, expected := range tests {
+		assert.Equal(t, expected, HashTag(key), key)
+	}
+
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c", "d", "e"}))
+	profile, _ := ring.GetNode(HashTag("{user:42}:profile"))
+	sessions, _ := ring.GetNode(HashTag("{user:42}:sessions"))
+	assert.Equal(t, profile, sessions)
+}
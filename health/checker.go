@@ -0,0 +1,77 @@
+// Package health marks the nodes of a hashring down and up according to periodic health checks.
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/mugli/hashring"
+)
+
+// Checker checks whether a node is healthy. Check returns nil for a healthy node.
+type Checker interface {
+	Check(ctx context.Context, node hashring.Node) error
+}
+
+// CheckerFunc adapts a function to a Checker.
+type CheckerFunc func(ctx context.Context, node hashring.Node) error
+
+func (f CheckerFunc) Check(ctx context.Context, node hashring.Node) error {
+	return f(ctx, node)
+}
+
+// TCPChecker considers a node healthy when a TCP connection to it can be established.
+type TCPChecker struct {
+	Dialer  net.Dialer
+	Address func(node hashring.Node) string // Address returns the host:port to dial, node.String() if nil.
+}
+
+func (c *TCPChecker) Check(ctx context.Context, node hashring.Node) error {
+	address := node.String()
+	if c.Address != nil {
+		address = c.Address(node)
+	}
+
+	conn, err := c.Dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// HTTPChecker considers a node healthy when a GET request to it returns a 2xx status code.
+type HTTPChecker struct {
+	Client *http.Client                    // Client sends the requests, http.DefaultClient if nil.
+	URL    func(node hashring.Node) string // URL returns the URL to check, "http://" + node.String() + "/" if nil.
+}
+
+func (c *HTTPChecker) Check(ctx context.Context, node hashring.Node) error {
+	url := "http://" + node.String() + "/"
+	if c.URL != nil {
+		url = c.URL(node)
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("health: GET %s: %s", url, resp.Status)
+	}
+	return nil
+}
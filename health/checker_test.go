@@ -0,0 +1,52 @@
+package health
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mugli/hashring"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTCPChecker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	address := listener.Addr().String()
+
+	checker := &TCPChecker{}
+	assert.NoError(t, checker.Check(context.Background(), hashring.StringNode(address)))
+
+	listener.Close()
+	assert.Error(t, checker.Check(context.Background(), hashring.StringNode(address)))
+}
+
+func TestHTTPChecker(t *testing.T) {
+	var healthy atomic.Value
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/healthz", r.URL.Path)
+		if !healthy.Load().(bool) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	checker := &HTTPChecker{
+		URL: func(n hashring.Node) string {
+			return "http://" + n.String() + "/healthz"
+		},
+	}
+	address := hashring.StringNode(strings.TrimPrefix(server.URL, "http://"))
+	assert.NoError(t, checker.Check(context.Background(), address))
+
+	healthy.Store(false)
+	assert.EqualError(t, checker.Check(context.Background(), address),
+		"health: GET "+server.URL+"/healthz: 503 Service Unavailable")
+}
@@ -0,0 +1,157 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mugli/hashring"
+)
+
+// Target is the set of nodes checked by a Monitor. *hashring.HashRing and *hashring.Holder implement it,
+// a Holder also carries the marks over when its ring is replaced.
+type Target interface {
+	Nodes() []hashring.Node
+	IsDown(node hashring.Node) bool
+	MarkDown(node hashring.Node) bool
+	MarkUp(node hashring.Node) bool
+}
+
+// Config configures a Monitor. Zero values are replaced by the defaults.
+type Config struct {
+	Interval      time.Duration // Interval between two rounds of checks, 5s by default.
+	Timeout       time.Duration // Timeout of a single check, 1s by default.
+	FallThreshold int           // FallThreshold is the number of consecutive failures marking a node down, 3 by default.
+	RiseThreshold int           // RiseThreshold is the number of consecutive successes marking a node up again, 2 by default.
+
+	// OnChange is called after a node is marked down or up, err is the error of the last check.
+	// It's called from the goroutine running the checks, one node at a time.
+	OnChange func(node hashring.Node, up bool, err error)
+}
+
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = 5 * time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = time.Second
+	}
+	if c.FallThreshold <= 0 {
+		c.FallThreshold = 3
+	}
+	if c.RiseThreshold <= 0 {
+		c.RiseThreshold = 2
+	}
+	return c
+}
+
+// nodeHealth counts the consecutive results of the checks of a node. Whether the node is down is always
+// read from the target: marks can be cleared or set behind the back of the monitor, for instance when
+// the ring of a Holder is swapped.
+type nodeHealth struct {
+	failures  int
+	successes int
+}
+
+// Monitor periodically checks the nodes of a Target and marks them down and up.
+type Monitor struct {
+	target  Target
+	checker Checker
+	config  Config
+
+	mu     sync.Mutex // mu serializes rounds of checks
+	health map[string]*nodeHealth
+}
+
+// NewMonitor creates a Monitor checking the nodes of target with checker.
+func NewMonitor(target Target, checker Checker, config Config) *Monitor {
+	return &Monitor{
+		target:  target,
+		checker: checker,
+		config:  config.withDefaults(),
+		health:  make(map[string]*nodeHealth),
+	}
+}
+
+// Run checks the nodes right away, then every Interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs a single round of checks on every node of the target, concurrently,
+// and marks down or up the nodes crossing a threshold.
+func (m *Monitor) Check(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	nodes := m.target.Nodes()
+	errs := make([]error, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node hashring.Node) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+			defer cancel()
+			errs[i] = m.checker.Check(checkCtx, node)
+		}(i, node)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		// checks were cancelled, their failures don't say anything about the nodes
+		return
+	}
+
+	present := make(map[string]bool, len(nodes))
+	for i, node := range nodes {
+		present[node.String()] = true
+		m.record(node, errs[i])
+	}
+	for name := range m.health {
+		if !present[name] {
+			// node left the target
+			delete(m.health, name)
+		}
+	}
+}
+
+// record requires m.mu to be locked
+func (m *Monitor) record(node hashring.Node, err error) {
+	health, ok := m.health[node.String()]
+	if !ok {
+		health = &nodeHealth{}
+		m.health[node.String()] = health
+	}
+
+	if err != nil {
+		health.successes = 0
+		health.failures++
+		if health.failures >= m.config.FallThreshold && !m.target.IsDown(node) && m.target.MarkDown(node) {
+			m.notify(node, false, err)
+		}
+		return
+	}
+
+	health.failures = 0
+	health.successes++
+	if health.successes >= m.config.RiseThreshold && m.target.IsDown(node) && m.target.MarkUp(node) {
+		m.notify(node, true, nil)
+	}
+}
+
+func (m *Monitor) notify(node hashring.Node, up bool, err error) {
+	if m.config.OnChange != nil {
+		m.config.OnChange(node, up, err)
+	}
+}
@@ -0,0 +1,138 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mugli/hashring"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ Target = (*hashring.HashRing)(nil)
+	_ Target = (*hashring.Holder)(nil)
+)
+
+// fakeChecker fails the checks of the nodes in failing.
+type fakeChecker struct {
+	mu      sync.Mutex
+	failing map[string]bool
+}
+
+func (c *fakeChecker) set(name string, failing bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failing[name] = failing
+}
+
+func (c *fakeChecker) Check(_ context.Context, n hashring.Node) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failing[n.String()] {
+		return errors.New("unhealthy")
+	}
+	return nil
+}
+
+type change struct {
+	node string
+	up   bool
+}
+
+func TestMonitorThresholds(t *testing.T) {
+	ring := hashring.New([]hashring.Node{hashring.StringNode("a"), hashring.StringNode("b"), hashring.StringNode("c")})
+	checker := &fakeChecker{failing: map[string]bool{"b": true}}
+	changes := make([]change, 0)
+	monitor := NewMonitor(ring, checker, Config{
+		FallThreshold: 2,
+		RiseThreshold: 2,
+		OnChange: func(n hashring.Node, up bool, err error) {
+			assert.Equal(t, up, err == nil)
+			changes = append(changes, change{n.String(), up})
+		},
+	})
+
+	ctx := context.Background()
+	monitor.Check(ctx)
+	assert.False(t, ring.IsDown(hashring.StringNode("b")))
+
+	monitor.Check(ctx)
+	assert.True(t, ring.IsDown(hashring.StringNode("b")))
+	owner, _ := ring.GetNode("test1")
+	assert.NotEqual(t, hashring.StringNode("b"), owner)
+
+	checker.set("b", false)
+	monitor.Check(ctx)
+	assert.True(t, ring.IsDown(hashring.StringNode("b")))
+	monitor.Check(ctx)
+	assert.False(t, ring.IsDown(hashring.StringNode("b")))
+
+	assert.Equal(t, []change{{"b", false}, {"b", true}}, changes)
+}
+
+func TestMonitorFlapping(t *testing.T) {
+	ring := hashring.New([]hashring.Node{hashring.StringNode("a")})
+	checker := &fakeChecker{failing: map[string]bool{}}
+	monitor := NewMonitor(ring, checker, Config{FallThreshold: 2})
+
+	for i := 0; i < 5; i++ {
+		checker.set("a", i%2 == 0)
+		monitor.Check(context.Background())
+	}
+	assert.False(t, ring.IsDown(hashring.StringNode("a")))
+}
+
+func TestMonitorMarksDownAfterSwap(t *testing.T) {
+	nodes := []hashring.Node{hashring.StringNode("a"), hashring.StringNode("b")}
+	holder := hashring.NewHolder(hashring.New(nodes))
+	checker := &fakeChecker{failing: map[string]bool{"a": true}}
+	monitor := NewMonitor(holder, checker, Config{FallThreshold: 1})
+
+	monitor.Check(context.Background())
+	assert.True(t, holder.IsDown(hashring.StringNode("a")))
+
+	// the swapped ring doesn't carry the mark, the monitor must set it again
+	holder.Swap(hashring.New(nodes))
+	assert.False(t, holder.IsDown(hashring.StringNode("a")))
+	monitor.Check(context.Background())
+	assert.True(t, holder.IsDown(hashring.StringNode("a")))
+
+	// a mark cleared by another source while the node is still failing is set again too
+	holder.MarkUp(hashring.StringNode("a"))
+	monitor.Check(context.Background())
+	assert.True(t, holder.IsDown(hashring.StringNode("a")))
+}
+
+func TestMonitorRun(t *testing.T) {
+	ring := hashring.New([]hashring.Node{hashring.StringNode("a"), hashring.StringNode("b")})
+	checker := &fakeChecker{failing: map[string]bool{"a": true}}
+	down := make(chan hashring.Node, 1)
+	monitor := NewMonitor(ring, checker, Config{
+		Interval:      time.Millisecond,
+		FallThreshold: 3,
+		OnChange: func(n hashring.Node, up bool, err error) {
+			down <- n
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		monitor.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case n := <-down:
+		assert.Equal(t, hashring.StringNode("a"), n)
+	case <-time.After(5 * time.Second):
+		t.Error("node wasn't marked down")
+	}
+	assert.True(t, ring.IsDown(hashring.StringNode("a")))
+
+	cancel()
+	<-done
+}
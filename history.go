@@ -0,0 +1,86 @@
+package hashring
+
+import (
+	"sort"
+	"sync"
+)
+
+// History keeps the most recent rings of a lineage, the rings derived from each other with
+// AddNode, RemoveNode and Update, to answer which node owned a key at a given epoch.
+// During migrations it lets the read path consult the previous owner when the new owner misses.
+// History is safe for concurrent use.
+type History struct {
+	limit int
+	rings []*HashRing // rings are sorted by epoch
+	mu    sync.RWMutex
+}
+
+// NewHistory creates a History retaining at most limit rings, the oldest ones are evicted first.
+func NewHistory(limit int) *History {
+	if limit < 1 {
+		panic("limit must be positive")
+	}
+	return &History{limit: limit}
+}
+
+// Record adds ring to the history. Recording an epoch again replaces the previous ring.
+func (h *History) Record(ring *HashRing) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	epoch := ring.Epoch()
+	pos := sort.Search(len(h.rings), func(i int) bool { return h.rings[i].Epoch() >= epoch })
+	if pos < len(h.rings) && h.rings[pos].Epoch() == epoch {
+		h.rings[pos] = ring
+		return
+	}
+
+	h.rings = append(h.rings, nil)
+	copy(h.rings[pos+1:], h.rings[pos:])
+	h.rings[pos] = ring
+
+	if len(h.rings) > h.limit {
+		h.rings = append(h.rings[:0], h.rings[len(h.rings)-h.limit:]...)
+	}
+}
+
+// At returns the ring in effect at epoch, the recorded ring with the greatest epoch not after it.
+// ok is false if epoch is older than every retained ring.
+func (h *History) At(epoch uint64) (ring *HashRing, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	pos := sort.Search(len(h.rings), func(i int) bool { return h.rings[i].Epoch() > epoch })
+	if pos == 0 {
+		return nil, false
+	}
+	return h.rings[pos-1], true
+}
+
+// Previous returns the ring in effect right before epoch.
+func (h *History) Previous(epoch uint64) (ring *HashRing, ok bool) {
+	if epoch == 0 {
+		return nil, false
+	}
+	return h.At(epoch - 1)
+}
+
+// Latest returns the ring with the greatest recorded epoch.
+func (h *History) Latest() (ring *HashRing, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.rings) == 0 {
+		return nil, false
+	}
+	return h.rings[len(h.rings)-1], true
+}
+
+// GetNodeAt returns the node owning stringKey at epoch.
+func (h *History) GetNodeAt(stringKey string, epoch uint64) (node Node, ok bool) {
+	ring, ok := h.At(epoch)
+	if !ok {
+		return nil, false
+	}
+	return ring.GetNode(stringKey)
+}
@@ -0,0 +1,72 @@
+package hashring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEpochs(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+	assert.Equal(t, uint64(1), ring.Epoch())
+	_, _, ok := ring.Parent()
+	assert.False(t, ok)
+
+	added := ring.AddNode(myNode("d"))
+	assert.Equal(t, uint64(2), added.Epoch())
+	epoch, fingerprint, ok := added.Parent()
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), epoch)
+	assert.Equal(t, ring.Fingerprint(), fingerprint)
+
+	assert.Same(t, added, added.AddNode(myNode("d")))
+	assert.Same(t, added, added.RemoveNode(myNode("e")))
+	assert.Equal(t, uint64(3), added.RemoveNode(myNode("d")).Epoch())
+}
+
+func TestUpdate(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+
+	updated := ring.Update(stringSliceToNodeSlice([]string{"d", "e", "a"}), stringSliceToNodeSlice([]string{"b", "x"}))
+	assert.Equal(t, uint64(2), updated.Epoch())
+	assert.Equal(t, New(stringSliceToNodeSlice([]string{"a", "c", "d", "e"})).Fingerprint(), updated.Fingerprint())
+
+	assert.Same(t, ring, ring.Update(stringSliceToNodeSlice([]string{"a"}), stringSliceToNodeSlice([]string{"x"})))
+	assert.Equal(t, ring.Fingerprint(), ring.Update(nil, stringSliceToNodeSlice([]string{"a", "b", "c"})).Update(stringSliceToNodeSlice([]string{"a", "b", "c"}), nil).Fingerprint())
+}
+
+func TestHistory(t *testing.T) {
+	history := NewHistory(2)
+	_, ok := history.Latest()
+	assert.False(t, ok)
+
+	abc := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+	abcd := abc.AddNode(myNode("d"))
+	abcdef := abcd.AddNode(myNode("e")).AddNode(myNode("f"))
+
+	history.Record(abcd)
+	history.Record(abc)
+
+	node, ok := history.GetNodeAt("test", 1)
+	assert.True(t, ok)
+	assert.Equal(t, myNode("a"), node)
+	node, ok = history.GetNodeAt("test", 2)
+	assert.True(t, ok)
+	assert.Equal(t, myNode("d"), node)
+
+	history.Record(abcdef)
+	_, ok = history.At(1)
+	assert.False(t, ok, "epoch 1 should be evicted")
+
+	ring, ok := history.At(3)
+	assert.True(t, ok)
+	assert.Same(t, abcd, ring, "epoch 3 wasn't recorded, epoch 2 was in effect")
+
+	ring, ok = history.Previous(abcdef.Epoch())
+	assert.True(t, ok)
+	assert.Same(t, abcd, ring)
+
+	ring, ok = history.Latest()
+	assert.True(t, ok)
+	assert.Same(t, abcdef, ring)
+}
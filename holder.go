@@ -0,0 +1,371 @@
+package hashring
+
+import (
+	"fmt"
+	"sync"
+)
+
+// EventType is the kind of change described by an Event.
+type EventType int
+
+const (
+	// NodeAdded is sent when a node joins the ring.
+	NodeAdded EventType = iota
+	// NodeRemoved is sent when a node leaves the ring.
+	NodeRemoved
+	// NodeStateChanged is sent when the NodeState of a node changes.
+	NodeStateChanged
+	// NodeDown is sent when a node is marked down.
+	NodeDown
+	// NodeUp is sent when a node marked down is marked up again.
+	NodeUp
+)
+
+func (t EventType) String() string {
+	switch t {
+	case NodeAdded:
+		return "added"
+	case NodeRemoved:
+		return "removed"
+	case NodeStateChanged:
+		return "state changed"
+	case NodeDown:
+		return "down"
+	case NodeUp:
+		return "up"
+	default:
+		return fmt.Sprintf("EventType(%d)", int(t))
+	}
+}
+
+// MovedSummary sums up the ranges changing primary owner with a ring update, see Diff.
+type MovedSummary struct {
+	Ranges   int
+	Fraction float64
+}
+
+// Event describes a change of the ring held by a Holder.
+// A single update adding or removing several nodes sends one event per node,
+// all of them sharing the same epochs and MovedSummary.
+type Event struct {
+	Type     EventType
+	Node     Node
+	OldState NodeState // OldState is the state of the node before a NodeStateChanged event.
+	NewState NodeState // NewState is the state of the node after a NodeStateChanged event.
+	OldEpoch uint64
+	NewEpoch uint64
+	Moved    MovedSummary
+	Ring     *HashRing // Ring is the ring after the change.
+}
+
+// Holder holds the current HashRing of a process. Components share a Holder instead of a ring:
+// they look up keys with Ring() and subscribe to its changes.
+// Holder is safe for concurrent use, updates are applied one at a time.
+type Holder struct {
+	ring          *HashRing
+	subscriptions map[*subscription]bool
+	mu            sync.RWMutex // mu guards ring and subscriptions
+	updateMu      sync.Mutex   // updateMu serializes updates so that events are sent in order
+}
+
+// NewHolder creates a Holder starting with ring.
+func NewHolder(ring *HashRing) *Holder {
+	return &Holder{
+		ring:          ring,
+		subscriptions: make(map[*subscription]bool),
+	}
+}
+
+// Ring returns the current ring.
+func (h *Holder) Ring() *HashRing {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.ring
+}
+
+// Nodes returns the nodes of the current ring.
+func (h *Holder) Nodes() []Node {
+	return h.Ring().Nodes()
+}
+
+// AddNode adds node to the current ring.
+func (h *Holder) AddNode(node Node) *HashRing {
+	return h.update(func(ring *HashRing) *HashRing { return ring.AddNode(node) })
+}
+
+// RemoveNode removes node from the current ring.
+func (h *Holder) RemoveNode(node Node) *HashRing {
+	return h.update(func(ring *HashRing) *HashRing { return ring.RemoveNode(node) })
+}
+
+// Update adds and removes several nodes at once, see HashRing.Update.
+func (h *Holder) Update(add []Node, remove []Node) *HashRing {
+	return h.update(func(ring *HashRing) *HashRing { return ring.Update(add, remove) })
+}
+
+// SetNodes makes nodes the exact membership of the ring, adding and removing the difference
+// with the current ring in a single update. Nodes are matched by their String() representation,
+// so keys don't move when a provider lists the same nodes in another order.
+func (h *Holder) SetNodes(nodes []Node) *HashRing {
+	return h.update(func(ring *HashRing) *HashRing {
+		current := make(map[string]bool)
+		for _, node := range ring.Nodes() {
+			current[node.String()] = true
+		}
+
+		wanted := make(map[string]bool, len(nodes))
+		add := make([]Node, 0)
+		for _, node := range nodes {
+			wanted[node.String()] = true
+			if !current[node.String()] {
+				add = append(add, node)
+			}
+		}
+
+		remove := make([]Node, 0)
+		for _, node := range ring.Nodes() {
+			if !wanted[node.String()] {
+				remove = append(remove, node)
+			}
+		}
+		return ring.Update(add, remove)
+	})
+}
+
+// SetNodeState changes the state of node, see HashRing.SetNodeState.
+func (h *Holder) SetNodeState(node Node, state NodeState) *HashRing {
+	return h.update(func(ring *HashRing) *HashRing { return ring.SetNodeState(node, state) })
+}
+
+// Swap replaces the current ring, for instance by one restored from a Snapshot.
+// Events are computed by comparing the nodes of both rings.
+func (h *Holder) Swap(ring *HashRing) *HashRing {
+	return h.update(func(*HashRing) *HashRing { return ring })
+}
+
+// IsDown reports whether node is marked down in the current ring.
+func (h *Holder) IsDown(node Node) bool {
+	return h.Ring().IsDown(node)
+}
+
+// MarkDown marks node down in the current ring, see HashRing.MarkDown.
+// The mark is carried over to the rings replacing it.
+func (h *Holder) MarkDown(node Node) bool {
+	h.updateMu.Lock()
+	defer h.updateMu.Unlock()
+
+	ring := h.Ring()
+	if !ring.MarkDown(node) {
+		return false
+	}
+	h.publish([]Event{{Type: NodeDown, Node: node, OldEpoch: ring.Epoch(), NewEpoch: ring.Epoch(), Ring: ring}})
+	return true
+}
+
+// MarkUp marks node up in the current ring, see HashRing.MarkUp.
+func (h *Holder) MarkUp(node Node) bool {
+	h.updateMu.Lock()
+	defer h.updateMu.Unlock()
+
+	ring := h.Ring()
+	if !ring.MarkUp(node) {
+		return false
+	}
+	h.publish([]Event{{Type: NodeUp, Node: node, OldEpoch: ring.Epoch(), NewEpoch: ring.Epoch(), Ring: ring}})
+	return true
+}
+
+// update replaces the current ring by the one returned by change and sends the resulting events.
+func (h *Holder) update(change func(ring *HashRing) *HashRing) *HashRing {
+	h.updateMu.Lock()
+	defer h.updateMu.Unlock()
+
+	old := h.Ring()
+	ring := change(old)
+	if ring == old {
+		return ring
+	}
+
+	h.mu.Lock()
+	h.ring = ring
+	h.mu.Unlock()
+
+	h.publish(ringEvents(old, ring))
+	return ring
+}
+
+// ringEvents lists the events turning old into new.
+func ringEvents(old, new *HashRing) []Event {
+	var moved MovedSummary
+	for _, change := range Diff(old, new) {
+		moved.Ranges++
+		moved.Fraction += change.Fraction
+	}
+	newEvent := func(eventType EventType, node Node) Event {
+		return Event{
+			Type:     eventType,
+			Node:     node,
+			OldEpoch: old.Epoch(),
+			NewEpoch: new.Epoch(),
+			Moved:    moved,
+			Ring:     new,
+		}
+	}
+
+	oldNodes := make(map[string]Node)
+	for _, node := range old.Nodes() {
+		oldNodes[node.String()] = node
+	}
+
+	events := make([]Event, 0)
+	for _, node := range new.Nodes() {
+		oldState := NodeActive
+		if oldNode, ok := oldNodes[node.String()]; ok {
+			delete(oldNodes, node.String())
+			oldState = old.NodeState(oldNode)
+		} else {
+			events = append(events, newEvent(NodeAdded, node))
+		}
+
+		if newState := new.NodeState(node); newState != oldState {
+			event := newEvent(NodeStateChanged, node)
+			event.OldState, event.NewState = oldState, newState
+			events = append(events, event)
+		}
+	}
+
+	for _, node := range old.Nodes() {
+		if _, ok := oldNodes[node.String()]; ok {
+			events = append(events, newEvent(NodeRemoved, node))
+		}
+	}
+	return events
+}
+
+// Subscribe calls fn with every event sent after Subscribe returns, in order.
+// fn is called from a dedicated goroutine, one event at a time, and never misses an event:
+// events are queued while fn is busy. cancel stops the subscription, events still queued are dropped.
+// cancel doesn't wait for fn, so it can be called from fn itself: a call of fn already in progress,
+// or about to start, may complete after cancel returns, but no other call follows.
+func (h *Holder) Subscribe(fn func(event Event)) (cancel func()) {
+	cancel, _ = h.subscribe(fn)
+	return cancel
+}
+
+// subscribe is like Subscribe, done is closed once the goroutine calling fn has returned.
+func (h *Holder) subscribe(fn func(event Event)) (cancel func(), done <-chan struct{}) {
+	s := newSubscription()
+	h.mu.Lock()
+	h.subscriptions[s] = true
+	h.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		s.run(fn)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscriptions, s)
+			h.mu.Unlock()
+			close(s.done)
+		})
+	}, finished
+}
+
+// SubscribeChan is like Subscribe, but delivers events on a channel.
+// The channel is closed once cancel is called.
+func (h *Holder) SubscribeChan() (events <-chan Event, cancel func()) {
+	ch := make(chan Event)
+	stopped := make(chan struct{})
+	cancelSubscription, done := h.subscribe(func(event Event) {
+		select {
+		case ch <- event:
+		case <-stopped:
+		}
+	})
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(stopped)
+			cancelSubscription()
+			// the goroutine may still be sending, wait for it before closing the channel
+			<-done
+			close(ch)
+		})
+	}
+}
+
+// publish requires updateMu to be locked
+func (h *Holder) publish(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subscriptions {
+		s.push(events)
+	}
+}
+
+// subscription queues the events of a subscriber so that publishing never blocks.
+type subscription struct {
+	queue []Event
+	mu    sync.Mutex
+	wake  chan struct{}
+	done  chan struct{}
+}
+
+func newSubscription() *subscription {
+	return &subscription{
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+func (s *subscription) push(events []Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, events...)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+		// already woken up
+	}
+}
+
+func (s *subscription) run(fn func(event Event)) {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			event := s.queue[0]
+			s.queue[0] = Event{}
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			fn(event)
+		}
+	}
+}
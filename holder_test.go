@@ -0,0 +1,176 @@
+package hashring
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func receiveEvents(t *testing.T, events <-chan Event, n int) []Event {
+	received := make([]Event, 0, n)
+	for len(received) < n {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d events, expected %d", len(received), n)
+		}
+	}
+	return received
+}
+
+func TestHolderEvents(t *testing.T) {
+	holder := NewHolder(New(stringSliceToNodeSlice([]string{"a", "b", "c"})))
+	events, cancel := holder.SubscribeChan()
+	defer cancel()
+
+	ring := holder.AddNode(myNode("d"))
+	assert.Same(t, ring, holder.Ring())
+	holder.AddNode(myNode("d"))
+	holder.Update(stringSliceToNodeSlice([]string{"e"}), stringSliceToNodeSlice([]string{"a"}))
+	holder.SetNodeState(myNode("b"), NodeDraining)
+	holder.MarkDown(myNode("c"))
+	holder.MarkDown(myNode("c"))
+	holder.MarkUp(myNode("c"))
+
+	received := receiveEvents(t, events, 6)
+	summary := make([]string, 0, len(received))
+	for _, event := range received {
+		summary = append(summary, fmt.Sprintf("%s %s %d->%d", event.Type, event.Node, event.OldEpoch, event.NewEpoch))
+	}
+	assert.Equal(t, []string{
+		"added d 1->2",
+		"added e 2->3",
+		"removed a 2->3",
+		"state changed b 3->4",
+		"down c 4->4",
+		"up c 4->4",
+	}, summary)
+
+	assert.Equal(t, 1, received[0].Moved.Ranges)
+	assert.Equal(t, Diff(New(stringSliceToNodeSlice([]string{"a", "b", "c"})), ring)[0].Fraction, received[0].Moved.Fraction)
+	assert.Equal(t, received[1].Moved, received[2].Moved)
+	assert.Equal(t, NodeActive, received[3].OldState)
+	assert.Equal(t, NodeDraining, received[3].NewState)
+	assert.Equal(t, MovedSummary{}, received[3].Moved)
+	assert.Same(t, holder.Ring(), received[5].Ring)
+}
+
+func TestHolderSwap(t *testing.T) {
+	holder := NewHolder(New(stringSliceToNodeSlice([]string{"a", "b"})))
+	events, cancel := holder.SubscribeChan()
+	defer cancel()
+
+	holder.Swap(New(stringSliceToNodeSlice([]string{"b", "c"})).SetNodeState(myNode("c"), NodeJoining))
+
+	received := receiveEvents(t, events, 3)
+	assert.Equal(t, NodeAdded, received[0].Type)
+	assert.Equal(t, NodeStateChanged, received[1].Type)
+	assert.Equal(t, NodeJoining, received[1].NewState)
+	assert.Equal(t, NodeRemoved, received[2].Type)
+	assert.Equal(t, myNode("a"), received[2].Node)
+}
+
+func TestHolderCancelFromSubscriber(t *testing.T) {
+	holder := NewHolder(New(stringSliceToNodeSlice([]string{"a", "b"})))
+
+	var mu sync.Mutex
+	calls := 0
+	removed := make(chan struct{})
+	var cancel func()
+	ready := make(chan struct{})
+	cancel = holder.Subscribe(func(event Event) {
+		<-ready
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		if event.Type == NodeRemoved && event.Node.String() == "b" {
+			cancel()
+			close(removed)
+		}
+	})
+	close(ready)
+
+	holder.RemoveNode(myNode("b"))
+	select {
+	case <-removed:
+	case <-time.After(time.Second):
+		t.Fatal("cancel called from the subscriber blocked")
+	}
+
+	holder.AddNode(myNode("c"))
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, calls)
+}
+
+func TestHolderOrdering(t *testing.T) {
+	holder := NewHolder(New(stringSliceToNodeSlice([]string{"a"})))
+
+	var mu sync.Mutex
+	epochs := make([]uint64, 0)
+	done := make(chan struct{})
+	cancel := holder.Subscribe(func(event Event) {
+		// slow subscriber, events must queue up
+		time.Sleep(time.Microsecond)
+		mu.Lock()
+		defer mu.Unlock()
+		epochs = append(epochs, event.NewEpoch)
+		if len(epochs) == 100 {
+			close(done)
+		}
+	})
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			node := myNode(fmt.Sprintf("node%d", i))
+			holder.AddNode(node)
+			holder.RemoveNode(node)
+		}(i)
+	}
+	wg.Wait()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("missing events")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, epoch := range epochs {
+		assert.Equal(t, uint64(i+2), epoch)
+	}
+}
+
+func TestHolderCancel(t *testing.T) {
+	holder := NewHolder(New(stringSliceToNodeSlice([]string{"a"})))
+	events, cancel := holder.SubscribeChan()
+
+	holder.AddNode(myNode("b"))
+	cancel()
+	cancel()
+
+	// the pending event may or may not be delivered, but the channel gets closed
+	for range events {
+	}
+	holder.AddNode(myNode("c"))
+}
+
+func TestHolderSetNodes(t *testing.T) {
+	holder := NewHolder(New(stringSliceToNodeSlice([]string{"a", "b", "c"})))
+
+	ring := holder.Ring()
+	assert.Same(t, ring, holder.SetNodes(stringSliceToNodeSlice([]string{"c", "a", "b", "a"})))
+
+	ring = holder.SetNodes(stringSliceToNodeSlice([]string{"d", "b", "c"}))
+	assert.Equal(t, uint64(2), ring.Epoch())
+	assert.Equal(t, stringSliceToNodeSlice([]string{"b", "c", "d"}), ring.Nodes())
+}
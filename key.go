@@ -3,6 +3,7 @@ package hashring
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 )
 
 type Int64PairHashKey struct {
@@ -18,6 +19,26 @@ func (k *Int64PairHashKey) Less(other HashKey) bool {
 	return k.High == o.High && k.Low < o.Low
 }
 
+// Position returns the location of the key on the ring as a fraction in [0, 1).
+// Only the High half is taken into account, Low is far below float64 precision.
+func (k *Int64PairHashKey) Position() float64 {
+	// flipping the sign bit keeps the signed ordering used by Less
+	pos := float64(uint64(k.High)^(1<<63)) / math.Exp2(64)
+	if pos >= 1 {
+		// rounding may push the largest keys to exactly 1
+		return math.Nextafter(1, 0)
+	}
+	return pos
+}
+
+// MarshalBinary encodes the key in the 16 bytes format read by NewInt64PairHashKey.
+func (k *Int64PairHashKey) MarshalBinary() ([]byte, error) {
+	bytes := make([]byte, 16)
+	binary.LittleEndian.PutUint64(bytes[:8], uint64(k.High))
+	binary.LittleEndian.PutUint64(bytes[8:], uint64(k.Low))
+	return bytes, nil
+}
+
 func NewInt64PairHashKey(bytes []byte) (HashKey, error) {
 	const expected = 16
 	if len(bytes) != expected {
@@ -0,0 +1,140 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mugli/hashring"
+)
+
+// Resolver is the part of *net.Resolver used by DNSWatcher. It can be replaced by a fake in tests.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// DNSOptions configures a DNSWatcher.
+type DNSOptions struct {
+	Resolver Resolver      // Resolver resolves the records, net.DefaultResolver by default.
+	Port     int           // Port is appended to the addresses of A/AAAA records, nodes are bare IPs if 0.
+	Interval time.Duration // Interval between two resolutions, 30s by default.
+	Timeout  time.Duration // Timeout of a resolution, 5s by default.
+	NewNode  NewNode       // NewNode creates the nodes from their host:port endpoint, hashring.StringNode by default.
+	OnError  func(error)   // OnError is called when Run fails to resolve the records.
+}
+
+// DNSWatcher resolves DNS records on an interval and applies the endpoints they point to to a holder.
+// Only the difference with the current ring is applied, so records returned in another order
+// don't move any key.
+type DNSWatcher struct {
+	holder  *hashring.Holder
+	options DNSOptions
+	resolve func(ctx context.Context) ([]string, error)
+	mu      sync.Mutex
+}
+
+// NewSRVWatcher creates a DNSWatcher using the SRV records of _service._proto.name,
+// nodes are named target:port.
+func NewSRVWatcher(holder *hashring.Holder, service, proto, name string, options DNSOptions) *DNSWatcher {
+	w := newDNSWatcher(holder, options)
+	w.resolve = func(ctx context.Context) ([]string, error) {
+		_, records, err := w.options.Resolver.LookupSRV(ctx, service, proto, name)
+		if err != nil {
+			return nil, err
+		}
+		endpoints := make([]string, 0, len(records))
+		for _, record := range records {
+			target := strings.TrimSuffix(record.Target, ".")
+			endpoints = append(endpoints, net.JoinHostPort(target, strconv.Itoa(int(record.Port))))
+		}
+		return endpoints, nil
+	}
+	return w
+}
+
+// NewHostWatcher creates a DNSWatcher using the A and AAAA records of host,
+// nodes are named ip:port, or ip if no Port is configured.
+func NewHostWatcher(holder *hashring.Holder, host string, options DNSOptions) *DNSWatcher {
+	w := newDNSWatcher(holder, options)
+	w.resolve = func(ctx context.Context) ([]string, error) {
+		addrs, err := w.options.Resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		endpoints := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			if w.options.Port == 0 {
+				endpoints = append(endpoints, addr.String())
+			} else {
+				endpoints = append(endpoints, net.JoinHostPort(addr.String(), strconv.Itoa(w.options.Port)))
+			}
+		}
+		return endpoints, nil
+	}
+	return w
+}
+
+func newDNSWatcher(holder *hashring.Holder, options DNSOptions) *DNSWatcher {
+	if options.Resolver == nil {
+		options.Resolver = net.DefaultResolver
+	}
+	if options.Interval <= 0 {
+		options.Interval = 30 * time.Second
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 5 * time.Second
+	}
+	options.NewNode = options.NewNode.orDefault()
+	return &DNSWatcher{
+		holder:  holder,
+		options: options,
+	}
+}
+
+// Reload resolves the records and applies the endpoints to the holder.
+// A resolution returning no endpoint is rejected rather than emptying the ring.
+func (w *DNSWatcher) Reload(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, w.options.Timeout)
+	defer cancel()
+
+	endpoints, err := w.resolve(ctx)
+	if err != nil {
+		return fmt.Errorf("membership: %w", err)
+	}
+	if len(endpoints) == 0 {
+		return fmt.Errorf("membership: no DNS records found")
+	}
+
+	nodes := make([]hashring.Node, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		nodes = append(nodes, w.options.NewNode(endpoint))
+	}
+	w.holder.SetNodes(nodes)
+	return nil
+}
+
+// Run resolves the records right away, then every Interval until ctx is done.
+// Resolution errors are reported to OnError and the current ring is kept.
+func (w *DNSWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Reload(ctx); err != nil && ctx.Err() == nil && w.options.OnError != nil {
+			w.options.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
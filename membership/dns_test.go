@@ -0,0 +1,93 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/mugli/hashring"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver struct {
+	mu    sync.Mutex
+	srv   []*net.SRV
+	addrs []net.IPAddr
+	err   error
+}
+
+func (r *fakeResolver) set(srv []*net.SRV, addrs []net.IPAddr, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.srv, r.addrs, r.err = srv, addrs, err
+}
+
+func (r *fakeResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if service != "memcache" || proto != "tcp" || name != "example.com" {
+		return "", nil, errors.New("unexpected lookup")
+	}
+	return "_memcache._tcp.example.com.", r.srv, r.err
+}
+
+func (r *fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if host != "cache.example.com" {
+		return nil, errors.New("unexpected lookup")
+	}
+	return r.addrs, r.err
+}
+
+var _ Resolver = net.DefaultResolver
+
+func TestSRVWatcher(t *testing.T) {
+	resolver := &fakeResolver{}
+	resolver.set([]*net.SRV{
+		{Target: "cache-1.example.com.", Port: 11211},
+		{Target: "cache-2.example.com.", Port: 11211},
+	}, nil, nil)
+
+	holder := hashring.NewHolder(hashring.New([]hashring.Node{}))
+	watcher := NewSRVWatcher(holder, "memcache", "tcp", "example.com", DNSOptions{Resolver: resolver})
+
+	ctx := context.Background()
+	if assert.NoError(t, watcher.Reload(ctx)) {
+		assert.Equal(t, []string{"cache-1.example.com:11211", "cache-2.example.com:11211"}, nodeNames(holder.Ring()))
+	}
+	epoch := holder.Ring().Epoch()
+
+	// records in another order don't move keys
+	resolver.set([]*net.SRV{
+		{Target: "cache-2.example.com.", Port: 11211},
+		{Target: "cache-1.example.com.", Port: 11211},
+	}, nil, nil)
+	assert.NoError(t, watcher.Reload(ctx))
+	assert.Equal(t, epoch, holder.Ring().Epoch())
+
+	// failures and empty answers keep the current ring
+	resolver.set(nil, nil, errors.New("SERVFAIL"))
+	assert.EqualError(t, watcher.Reload(ctx), "membership: SERVFAIL")
+	resolver.set(nil, nil, nil)
+	assert.Error(t, watcher.Reload(ctx))
+	assert.Equal(t, epoch, holder.Ring().Epoch())
+}
+
+func TestHostWatcher(t *testing.T) {
+	resolver := &fakeResolver{}
+	resolver.set(nil, []net.IPAddr{{IP: net.ParseIP("10.0.0.1")}, {IP: net.ParseIP("fd00::1")}}, nil)
+
+	holder := hashring.NewHolder(hashring.New([]hashring.Node{}))
+	watcher := NewHostWatcher(holder, "cache.example.com", DNSOptions{Resolver: resolver, Port: 11211})
+	if assert.NoError(t, watcher.Reload(context.Background())) {
+		assert.Equal(t, []string{"10.0.0.1:11211", "[fd00::1]:11211"}, nodeNames(holder.Ring()))
+	}
+
+	watcher = NewHostWatcher(holder, "cache.example.com", DNSOptions{Resolver: resolver})
+	if assert.NoError(t, watcher.Reload(context.Background())) {
+		assert.Equal(t, []string{"10.0.0.1", "fd00::1"}, nodeNames(holder.Ring()))
+	}
+}
@@ -0,0 +1,172 @@
+package membership
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mugli/hashring"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the format of a node list file.
+type Format int
+
+const (
+	// FormatAuto picks the format from the file extension: .json, .yaml and .yml files
+	// are JSON and YAML, every other file is FormatLines.
+	FormatAuto Format = iota
+	// FormatLines is one node per line, empty lines and lines starting with # are ignored.
+	FormatLines
+	// FormatJSON is an array of node names, or an object with a "nodes" array.
+	FormatJSON
+	// FormatYAML is a sequence of node names, or a mapping with a "nodes" sequence.
+	FormatYAML
+)
+
+// FileOptions configures a FileWatcher.
+type FileOptions struct {
+	Format   Format
+	Interval time.Duration // Interval between two polls of the file, 10s by default.
+	NewNode  NewNode       // NewNode creates the nodes found in the file, hashring.StringNode by default.
+	OnError  func(error)   // OnError is called when Run fails to reload the file.
+}
+
+// FileWatcher applies the node list of a file to a holder, polling it for changes.
+type FileWatcher struct {
+	holder  *hashring.Holder
+	path    string
+	options FileOptions
+
+	mu   sync.Mutex
+	last []byte // last is the content of the file last applied
+}
+
+// NewFileWatcher creates a FileWatcher applying the node list of the file at path to holder.
+func NewFileWatcher(holder *hashring.Holder, path string, options FileOptions) *FileWatcher {
+	if options.Interval <= 0 {
+		options.Interval = 10 * time.Second
+	}
+	options.NewNode = options.NewNode.orDefault()
+	return &FileWatcher{
+		holder:  holder,
+		path:    path,
+		options: options,
+	}
+}
+
+// Reload reads the file and applies its node list to the holder if the file changed since the last reload.
+// Only the difference with the current ring is applied, in a single update.
+// An empty node list is rejected rather than emptying the ring.
+func (w *FileWatcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	content, err := os.ReadFile(w.path)
+	if err != nil {
+		return err
+	}
+	if w.last != nil && bytes.Equal(content, w.last) {
+		return nil
+	}
+
+	names, err := ParseNodes(content, w.format())
+	if err != nil {
+		return fmt.Errorf("membership: parsing %s: %w", w.path, err)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("membership: %s has no nodes", w.path)
+	}
+
+	nodes := make([]hashring.Node, 0, len(names))
+	for _, name := range names {
+		nodes = append(nodes, w.options.NewNode(name))
+	}
+	w.holder.SetNodes(nodes)
+	w.last = content
+	return nil
+}
+
+func (w *FileWatcher) format() Format {
+	if w.options.Format != FormatAuto {
+		return w.options.Format
+	}
+	switch strings.ToLower(filepath.Ext(w.path)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	default:
+		return FormatLines
+	}
+}
+
+// Run reloads the file right away, then every Interval until ctx is done.
+// Reload errors are reported to OnError and the current ring is kept.
+func (w *FileWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Reload(); err != nil && w.options.OnError != nil {
+			w.options.OnError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ParseNodes parses a node list in the given format. FormatAuto is treated as FormatLines.
+func ParseNodes(content []byte, format Format) ([]string, error) {
+	switch format {
+	case FormatJSON:
+		return parseStructured(content, json.Unmarshal)
+	case FormatYAML:
+		return parseStructured(content, yaml.Unmarshal)
+	default:
+		return parseLines(content)
+	}
+}
+
+func parseLines(content []byte) ([]string, error) {
+	names := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	return names, scanner.Err()
+}
+
+// parseStructured accepts a list of names or an object with a "nodes" list.
+func parseStructured(content []byte, unmarshal func([]byte, interface{}) error) ([]string, error) {
+	var names []string
+	if err := unmarshal(content, &names); err == nil {
+		return names, nil
+	}
+
+	var object struct {
+		Nodes []string `json:"nodes" yaml:"nodes"`
+	}
+	if err := unmarshal(content, &object); err != nil {
+		return nil, err
+	}
+	if object.Nodes == nil {
+		return nil, errors.New(`expected a list of nodes or a "nodes" list`)
+	}
+	return object.Nodes, nil
+}
@@ -0,0 +1,116 @@
+package membership
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mugli/hashring"
+	"github.com/stretchr/testify/assert"
+)
+
+func nodeNames(ring *hashring.HashRing) []string {
+	names := make([]string, 0)
+	for _, node := range ring.Nodes() {
+		names = append(names, node.String())
+	}
+	return names
+}
+
+func TestParseNodes(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		format  Format
+	}{
+		"lines":       {"a\n# comment\n\n  b  \nc", FormatLines},
+		"json":        {`["a", "b", "c"]`, FormatJSON},
+		"json object": {`{"nodes": ["a", "b", "c"]}`, FormatJSON},
+		"yaml":        {"- a\n- b\n- c\n", FormatYAML},
+		"yaml object": {"nodes:\n  - a\n  - b\n  - c\n", FormatYAML},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			names, err := ParseNodes([]byte(test.content), test.format)
+			if assert.NoError(t, err) {
+				assert.Equal(t, []string{"a", "b", "c"}, names)
+			}
+		})
+	}
+
+	_, err := ParseNodes([]byte(`{"servers": ["a"]}`), FormatJSON)
+	assert.Error(t, err)
+	_, err = ParseNodes([]byte(`[1, 2`), FormatJSON)
+	assert.Error(t, err)
+}
+
+func TestFileWatcherReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nodes.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("- a\n- b\n"), 0o600))
+
+	holder := hashring.NewHolder(hashring.New([]hashring.Node{}))
+	watcher := NewFileWatcher(holder, path, FileOptions{})
+
+	if assert.NoError(t, watcher.Reload()) {
+		assert.Equal(t, []string{"a", "b"}, nodeNames(holder.Ring()))
+	}
+	epoch := holder.Ring().Epoch()
+
+	// same nodes in another order don't change the ring
+	assert.NoError(t, os.WriteFile(path, []byte("- b\n- a\n"), 0o600))
+	assert.NoError(t, watcher.Reload())
+	assert.Equal(t, epoch, holder.Ring().Epoch())
+
+	assert.NoError(t, os.WriteFile(path, []byte("- b\n- c\n"), 0o600))
+	assert.NoError(t, watcher.Reload())
+	assert.Equal(t, []string{"b", "c"}, nodeNames(holder.Ring()))
+	assert.Equal(t, epoch+1, holder.Ring().Epoch())
+
+	// broken and empty files keep the current ring
+	assert.NoError(t, os.WriteFile(path, []byte("- [b\n"), 0o600))
+	assert.Error(t, watcher.Reload())
+	assert.NoError(t, os.WriteFile(path, []byte(""), 0o600))
+	assert.Error(t, watcher.Reload())
+	assert.Equal(t, []string{"b", "c"}, nodeNames(holder.Ring()))
+}
+
+func TestFileWatcherRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers")
+	assert.NoError(t, os.WriteFile(path, []byte("a\n"), 0o600))
+
+	holder := hashring.NewHolder(hashring.New([]hashring.Node{}))
+	events, cancelEvents := holder.SubscribeChan()
+	defer cancelEvents()
+
+	watcher := NewFileWatcher(holder, path, FileOptions{
+		Interval: time.Millisecond,
+		OnError: func(err error) {
+			t.Error(err)
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watcher.Run(ctx)
+		close(done)
+	}()
+
+	expectEvent := func(eventType hashring.EventType, name string) {
+		select {
+		case event := <-events:
+			assert.Equal(t, eventType, event.Type)
+			assert.Equal(t, hashring.StringNode(name), event.Node)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event for %s", eventType, name)
+		}
+	}
+	expectEvent(hashring.NodeAdded, "a")
+
+	assert.NoError(t, os.WriteFile(path, []byte("b\n"), 0o600))
+	expectEvent(hashring.NodeAdded, "b")
+	expectEvent(hashring.NodeRemoved, "a")
+
+	cancel()
+	<-done
+}
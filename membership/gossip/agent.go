@@ -0,0 +1,592 @@
+// Package gossip lets peers discover each other and agree on a hashring without a central registry.
+//
+// Agents run a SWIM-style protocol: every protocol period each agent probes a random peer,
+// directly then through a few other peers, and suspects it when no acknowledgement comes back.
+// Suspected peers can refute the suspicion, otherwise they are declared dead after a timeout.
+// Membership updates are piggybacked on the probes and spread epidemically.
+//
+// Alive peers are members of the ring of a hashring.Holder, suspected peers are marked down
+// and dead peers are removed from it.
+package gossip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mugli/hashring"
+	"github.com/mugli/hashring/membership"
+)
+
+// State is the state of a member as seen by an agent.
+type State int
+
+const (
+	StateAlive State = iota
+	StateSuspect
+	StateDead
+)
+
+func (s State) String() string {
+	switch s {
+	case StateAlive:
+		return "alive"
+	case StateSuspect:
+		return "suspect"
+	default:
+		return "dead"
+	}
+}
+
+// Member is a peer known by an agent. Its name is the address of its transport.
+type Member struct {
+	Name        string
+	Incarnation uint64
+	State       State
+}
+
+// Config configures an Agent. Zero durations and counts are replaced by the defaults.
+type Config struct {
+	Transport Transport          // Transport carries the messages.
+	Holder    *hashring.Holder   // Holder receives the membership of the ring.
+	NewNode   membership.NewNode // NewNode creates the nodes of the members from their names, hashring.StringNode by default.
+
+	// AdvertiseAddr is the address the other agents reach this one at, it's the name of the agent.
+	// It defaults to the address of the transport, and is required when the transport listens on
+	// an unspecified address like 0.0.0.0:7946 or :7946.
+	AdvertiseAddr string
+
+	ProbeInterval    time.Duration // ProbeInterval is the protocol period, 1s by default.
+	ProbeTimeout     time.Duration // ProbeTimeout is how long a direct probe waits for an ack, 500ms by default.
+	IndirectChecks   int           // IndirectChecks is the number of peers asked to probe an unresponsive member, 3 by default.
+	SuspicionTimeout time.Duration // SuspicionTimeout is how long a member stays suspect before it's declared dead, 5s by default.
+	RetransmitMult   int           // RetransmitMult scales how many times an update is piggybacked, 4 by default.
+	MaxPiggyback     int           // MaxPiggyback is the maximum number of updates per message, 8 by default.
+}
+
+func (c Config) withDefaults() Config {
+	if c.ProbeInterval <= 0 {
+		c.ProbeInterval = time.Second
+	}
+	if c.ProbeTimeout <= 0 {
+		c.ProbeTimeout = c.ProbeInterval / 2
+	}
+	if c.IndirectChecks <= 0 {
+		c.IndirectChecks = 3
+	}
+	if c.SuspicionTimeout <= 0 {
+		c.SuspicionTimeout = 5 * c.ProbeInterval
+	}
+	if c.RetransmitMult <= 0 {
+		c.RetransmitMult = 4
+	}
+	if c.MaxPiggyback <= 0 {
+		c.MaxPiggyback = 8
+	}
+	if c.NewNode == nil {
+		c.NewNode = func(name string) hashring.Node { return hashring.StringNode(name) }
+	}
+	return c
+}
+
+type messageType string
+
+const (
+	typePing    messageType = "ping"
+	typePingReq messageType = "ping-req"
+	typeAck     messageType = "ack"
+	typeJoin    messageType = "join"
+	typeSync    messageType = "sync"
+	typeLeave   messageType = "leave"
+)
+
+type message struct {
+	Type    messageType `json:"type"`
+	Seq     uint64      `json:"seq,omitempty"`
+	Target  string      `json:"target,omitempty"` // Target is the member to probe for ping-req messages.
+	Updates []Member    `json:"updates,omitempty"`
+}
+
+type member struct {
+	Member
+	suspectedAt time.Time
+}
+
+type broadcast struct {
+	update    Member
+	transmits int
+}
+
+// Agent is a member of a gossip cluster keeping a hashring.Holder in sync with the alive members.
+type Agent struct {
+	config Config
+	name   string
+
+	mu          sync.Mutex
+	members     map[string]*member
+	applied     map[string]State // applied are the member states last applied to the holder
+	incarnation uint64
+	broadcasts  []*broadcast
+	handlers    map[uint64]func() // handlers are called when the ack of a sequence number is received
+	seq         uint64
+	probeOrder  []string
+	leaving     bool
+	synced      chan struct{} // synced is closed once a sync message is received after Join
+	syncedOnce  sync.Once
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// NewAgent creates an Agent and starts probing and answering peers.
+// Until Join is called the agent is alone in its cluster.
+func NewAgent(config Config) (*Agent, error) {
+	if config.Transport == nil || config.Holder == nil {
+		return nil, errors.New("gossip: Transport and Holder are required")
+	}
+	config = config.withDefaults()
+	name := config.AdvertiseAddr
+	if name == "" {
+		name = config.Transport.Addr()
+		if host, _, err := net.SplitHostPort(name); err == nil {
+			if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+				return nil, fmt.Errorf("gossip: transport listens on %s, AdvertiseAddr is required", name)
+			}
+		}
+	}
+
+	a := &Agent{
+		config:   config,
+		name:     name,
+		members:  make(map[string]*member),
+		applied:  make(map[string]State),
+		handlers: make(map[uint64]func()),
+		synced:   make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+	a.members[a.name] = &member{Member: Member{Name: a.name, State: StateAlive}}
+	a.mu.Lock()
+	a.syncRing()
+	a.mu.Unlock()
+
+	a.done.Add(2)
+	go a.receive()
+	go a.probeLoop()
+	return a, nil
+}
+
+// Name returns the name of the agent, its AdvertiseAddr.
+func (a *Agent) Name() string {
+	return a.name
+}
+
+// Members returns the members known by the agent, dead ones included, sorted by name.
+func (a *Agent) Members() []Member {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	members := make([]Member, 0, len(a.members))
+	for _, m := range a.members {
+		members = append(members, m.Member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Name < members[j].Name })
+	return members
+}
+
+// Join contacts the seeds and waits until one of them sends back the state of the cluster.
+// Join messages are sent again every ProbeInterval until ctx is done.
+func (a *Agent) Join(ctx context.Context, seeds ...string) error {
+	ticker := time.NewTicker(a.config.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		a.mu.Lock()
+		self := a.members[a.name].Member
+		a.mu.Unlock()
+		for _, seed := range seeds {
+			if seed != a.name {
+				a.send(seed, message{Type: typeJoin, Updates: []Member{self}})
+			}
+		}
+
+		select {
+		case <-a.synced:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Leave announces to the alive members that the agent is leaving, then stops it.
+// The transport isn't closed.
+func (a *Agent) Leave() {
+	a.mu.Lock()
+	a.leaving = true
+	self := a.members[a.name]
+	self.State = StateDead
+	peers := a.peers(StateAlive, StateSuspect)
+	update := self.Member
+	a.mu.Unlock()
+
+	for _, peer := range peers {
+		a.send(peer, message{Type: typeLeave, Updates: []Member{update}})
+	}
+	a.Stop()
+}
+
+// Stop stops the agent without telling its peers, they will detect it as failed.
+// The transport isn't closed.
+func (a *Agent) Stop() {
+	a.mu.Lock()
+	select {
+	case <-a.stop:
+	default:
+		close(a.stop)
+	}
+	a.mu.Unlock()
+	a.done.Wait()
+}
+
+func (a *Agent) receive() {
+	defer a.done.Done()
+
+	packets := a.config.Transport.Packets()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case packet, ok := <-packets:
+			if !ok {
+				return
+			}
+			var msg message
+			if err := json.Unmarshal(packet.Data, &msg); err != nil {
+				continue
+			}
+			a.handle(packet.From, msg)
+		}
+	}
+}
+
+func (a *Agent) handle(from string, msg message) {
+	a.mu.Lock()
+	for _, update := range msg.Updates {
+		a.apply(update)
+	}
+
+	switch msg.Type {
+	case typePing:
+		a.mu.Unlock()
+		a.send(from, message{Type: typeAck, Seq: msg.Seq})
+		return
+	case typePingReq:
+		seq := a.nextSeq()
+		a.handlers[seq] = func() {
+			a.send(from, message{Type: typeAck, Seq: msg.Seq})
+		}
+		a.expire(seq)
+		a.mu.Unlock()
+		a.send(msg.Target, message{Type: typePing, Seq: seq})
+		return
+	case typeAck:
+		handler := a.handlers[msg.Seq]
+		delete(a.handlers, msg.Seq)
+		a.mu.Unlock()
+		if handler != nil {
+			handler()
+		}
+		return
+	case typeJoin:
+		state := make([]Member, 0, len(a.members))
+		for _, m := range a.members {
+			state = append(state, m.Member)
+		}
+		a.mu.Unlock()
+		a.send(from, message{Type: typeSync, Updates: state})
+		return
+	case typeSync:
+		a.mu.Unlock()
+		a.syncedOnce.Do(func() { close(a.synced) })
+		return
+	case typeLeave:
+		// the departure is one of the updates, already applied
+	}
+	a.mu.Unlock()
+}
+
+// apply merges an update into the membership, following the SWIM precedence rules.
+// apply requires a.mu to be locked
+func (a *Agent) apply(update Member) {
+	if update.Name == a.name {
+		if update.State != StateAlive && !a.leaving && update.Incarnation >= a.incarnation {
+			// refute the suspicion with a newer incarnation
+			a.incarnation = update.Incarnation + 1
+			self := a.members[a.name]
+			self.Incarnation = a.incarnation
+			a.enqueue(self.Member)
+		}
+		return
+	}
+
+	current, ok := a.members[update.Name]
+	if ok && !overrides(update, current.Member) {
+		return
+	}
+	if !ok {
+		current = &member{}
+		a.members[update.Name] = current
+	}
+	if update.State == StateSuspect && current.State != StateSuspect {
+		current.suspectedAt = time.Now()
+	}
+	current.Member = update
+	a.enqueue(update)
+	a.syncRing()
+}
+
+// overrides reports whether update is newer than current.
+func overrides(update, current Member) bool {
+	switch update.State {
+	case StateAlive:
+		return update.Incarnation > current.Incarnation
+	case StateSuspect:
+		if current.State == StateAlive {
+			return update.Incarnation >= current.Incarnation
+		}
+		return update.Incarnation > current.Incarnation
+	default:
+		return current.State != StateDead && update.Incarnation >= current.Incarnation ||
+			update.Incarnation > current.Incarnation
+	}
+}
+
+// enqueue adds update to the updates piggybacked on the next messages, replacing older updates of the same member.
+// enqueue requires a.mu to be locked
+func (a *Agent) enqueue(update Member) {
+	for i, b := range a.broadcasts {
+		if b.update.Name == update.Name {
+			a.broadcasts = append(a.broadcasts[:i], a.broadcasts[i+1:]...)
+			break
+		}
+	}
+	a.broadcasts = append(a.broadcasts, &broadcast{update: update})
+}
+
+// piggyback returns the updates to attach to a message, the least transmitted first.
+// piggyback requires a.mu to be locked
+func (a *Agent) piggyback() []Member {
+	if len(a.broadcasts) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(a.broadcasts, func(i, j int) bool {
+		return a.broadcasts[i].transmits < a.broadcasts[j].transmits
+	})
+	limit := a.config.RetransmitMult * int(math.Ceil(math.Log10(float64(len(a.members)+1))))
+
+	updates := make([]Member, 0, a.config.MaxPiggyback)
+	kept := a.broadcasts[:0]
+	for _, b := range a.broadcasts {
+		if len(updates) < a.config.MaxPiggyback {
+			updates = append(updates, b.update)
+			b.transmits++
+		}
+		if b.transmits < limit {
+			kept = append(kept, b)
+		}
+	}
+	a.broadcasts = kept
+	return updates
+}
+
+// syncRing applies the membership to the holder. Members are only marked down or up when their state
+// changes, so that the marks set on the holder by other sources, like a health.Monitor, are kept.
+// syncRing requires a.mu to be locked
+func (a *Agent) syncRing() {
+	nodes := make([]hashring.Node, 0, len(a.members))
+	for _, m := range a.members {
+		if m.State != StateDead {
+			nodes = append(nodes, a.config.NewNode(m.Name))
+		}
+	}
+	a.config.Holder.SetNodes(nodes)
+
+	for _, m := range a.members {
+		previous, ok := a.applied[m.Name]
+		if ok && previous == m.State {
+			continue
+		}
+		node := a.config.NewNode(m.Name)
+		switch {
+		case m.State == StateSuspect:
+			a.config.Holder.MarkDown(node)
+		case m.State == StateAlive && previous == StateSuspect:
+			a.config.Holder.MarkUp(node)
+		}
+		if m.State == StateDead {
+			// removed from the ring with its mark
+			delete(a.applied, m.Name)
+		} else {
+			a.applied[m.Name] = m.State
+		}
+	}
+}
+
+func (a *Agent) send(to string, msg message) {
+	a.mu.Lock()
+	msg.Updates = append(msg.Updates, a.piggyback()...)
+	a.mu.Unlock()
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	_ = a.config.Transport.Send(to, data)
+}
+
+// nextSeq requires a.mu to be locked
+func (a *Agent) nextSeq() uint64 {
+	a.seq++
+	return a.seq
+}
+
+// expire forgets the ack handler of seq after a protocol period.
+func (a *Agent) expire(seq uint64) {
+	time.AfterFunc(a.config.ProbeInterval, func() {
+		a.mu.Lock()
+		delete(a.handlers, seq)
+		a.mu.Unlock()
+	})
+}
+
+// peers returns the names of the other members in the given states.
+// peers requires a.mu to be locked
+func (a *Agent) peers(states ...State) []string {
+	names := make([]string, 0, len(a.members))
+	for name, m := range a.members {
+		if name == a.name {
+			continue
+		}
+		for _, state := range states {
+			if m.State == state {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a *Agent) probeLoop() {
+	defer a.done.Done()
+
+	ticker := time.NewTicker(a.config.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+		a.probe()
+		a.expireSuspects()
+	}
+}
+
+// probe checks the next member in the probe order, directly then through other members.
+func (a *Agent) probe() {
+	a.mu.Lock()
+	target, ok := a.nextProbeTarget()
+	if !ok {
+		a.mu.Unlock()
+		return
+	}
+	acked := make(chan struct{})
+	var once sync.Once
+	seq := a.nextSeq()
+	a.handlers[seq] = func() { once.Do(func() { close(acked) }) }
+	a.expire(seq)
+	a.mu.Unlock()
+
+	a.send(target, message{Type: typePing, Seq: seq})
+	select {
+	case <-acked:
+		return
+	case <-a.stop:
+		return
+	case <-time.After(a.config.ProbeTimeout):
+	}
+
+	a.mu.Lock()
+	helpers := a.peers(StateAlive)
+	a.mu.Unlock()
+	rand.Shuffle(len(helpers), func(i, j int) { helpers[i], helpers[j] = helpers[j], helpers[i] })
+	sent := 0
+	for _, helper := range helpers {
+		if sent == a.config.IndirectChecks {
+			break
+		}
+		if helper != target {
+			a.send(helper, message{Type: typePingReq, Seq: seq, Target: target})
+			sent++
+		}
+	}
+
+	select {
+	case <-acked:
+		return
+	case <-a.stop:
+		return
+	case <-time.After(a.config.ProbeInterval - a.config.ProbeTimeout):
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if m, ok := a.members[target]; ok && m.State == StateAlive {
+		a.apply(Member{Name: target, Incarnation: m.Incarnation, State: StateSuspect})
+	}
+}
+
+// nextProbeTarget walks the members in a random order, shuffled again after every round.
+// nextProbeTarget requires a.mu to be locked
+func (a *Agent) nextProbeTarget() (string, bool) {
+	for {
+		if len(a.probeOrder) == 0 {
+			a.probeOrder = a.peers(StateAlive, StateSuspect)
+			if len(a.probeOrder) == 0 {
+				return "", false
+			}
+			rand.Shuffle(len(a.probeOrder), func(i, j int) {
+				a.probeOrder[i], a.probeOrder[j] = a.probeOrder[j], a.probeOrder[i]
+			})
+		}
+
+		target := a.probeOrder[0]
+		a.probeOrder = a.probeOrder[1:]
+		if m, ok := a.members[target]; ok && m.State != StateDead {
+			return target, true
+		}
+	}
+}
+
+// expireSuspects declares dead the members suspected for longer than SuspicionTimeout.
+func (a *Agent) expireSuspects() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, m := range a.members {
+		if m.State == StateSuspect && time.Since(m.suspectedAt) > a.config.SuspicionTimeout {
+			a.apply(Member{Name: m.Name, Incarnation: m.Incarnation, State: StateDead})
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package gossip
+
+import (
+	"context"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mugli/hashring"
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig(transport Transport) Config {
+	return Config{
+		Transport:        transport,
+		Holder:           hashring.NewHolder(hashring.New([]hashring.Node{})),
+		ProbeInterval:    20 * time.Millisecond,
+		ProbeTimeout:     10 * time.Millisecond,
+		SuspicionTimeout: 100 * time.Millisecond,
+	}
+}
+
+func startAgents(t *testing.T, network *Network, suspicionTimeout time.Duration, addrs ...string) []*Agent {
+	agents := make([]*Agent, 0, len(addrs))
+	for _, addr := range addrs {
+		transport, err := network.Transport(addr)
+		assert.Nil(t, err)
+		config := testConfig(transport)
+		if suspicionTimeout > 0 {
+			config.SuspicionTimeout = suspicionTimeout
+		}
+		agent, err := NewAgent(config)
+		assert.Nil(t, err)
+		t.Cleanup(agent.Stop)
+		agents = append(agents, agent)
+	}
+	return agents
+}
+
+func ringNames(holder *hashring.Holder) []string {
+	names := make([]string, 0)
+	for _, node := range holder.Nodes() {
+		names = append(names, node.String())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func join(t *testing.T, agents []*Agent) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, agent := range agents[1:] {
+		assert.Nil(t, agent.Join(ctx, agents[0].Name()))
+	}
+}
+
+func waitForRing(t *testing.T, agents []*Agent, expected []string) {
+	assert.Eventually(t, func() bool {
+		for _, agent := range agents {
+			if !assert.ObjectsAreEqual(expected, ringNames(agent.config.Holder)) {
+				return false
+			}
+		}
+		return true
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestAgentsConverge(t *testing.T) {
+	agents := startAgents(t, NewNetwork(), 0, "a", "b", "c")
+	join(t, agents)
+
+	waitForRing(t, agents, []string{"a", "b", "c"})
+	for _, agent := range agents {
+		for _, member := range agent.Members() {
+			assert.Equal(t, StateAlive, member.State)
+		}
+	}
+}
+
+func TestAgentsRemoveFailedMember(t *testing.T) {
+	network := NewNetwork()
+	agents := startAgents(t, network, 0, "a", "b", "c")
+	join(t, agents)
+	waitForRing(t, agents, []string{"a", "b", "c"})
+
+	agents[2].Stop()
+	assert.Nil(t, agents[2].config.Transport.Close())
+
+	waitForRing(t, agents[:2], []string{"a", "b"})
+	for _, member := range agents[0].Members() {
+		if member.Name == "c" {
+			assert.Equal(t, StateDead, member.State)
+		}
+	}
+}
+
+func TestAgentsMarkSuspectDown(t *testing.T) {
+	network := NewNetwork()
+	agents := startAgents(t, network, time.Hour, "a", "b")
+	join(t, agents)
+	waitForRing(t, agents, []string{"a", "b"})
+
+	agents[1].Stop()
+	assert.Nil(t, agents[1].config.Transport.Close())
+
+	assert.Eventually(t, func() bool {
+		return agents[0].config.Holder.IsDown(hashring.StringNode("b"))
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"a", "b"}, ringNames(agents[0].config.Holder))
+}
+
+func TestAgentsKeepOtherMarks(t *testing.T) {
+	network := NewNetwork()
+	agents := startAgents(t, network, 0, "a", "b", "c")
+	join(t, agents[:2])
+	waitForRing(t, agents[:2], []string{"a", "b"})
+
+	// marked down by another source, for instance a health.Monitor
+	holder := agents[0].config.Holder
+	holder.MarkDown(hashring.StringNode("b"))
+
+	// membership updates don't mark b up again
+	join(t, []*Agent{agents[0], agents[2]})
+	waitForRing(t, agents, []string{"a", "b", "c"})
+	assert.True(t, holder.IsDown(hashring.StringNode("b")))
+	assert.False(t, holder.IsDown(hashring.StringNode("c")))
+}
+
+func TestAgentLeave(t *testing.T) {
+	// failures aren't detected, only the announcement can remove c
+	agents := startAgents(t, NewNetwork(), time.Hour, "a", "b", "c")
+	join(t, agents)
+	waitForRing(t, agents, []string{"a", "b", "c"})
+
+	agents[2].Leave()
+
+	waitForRing(t, agents[:2], []string{"a", "b"})
+	for _, node := range agents[0].config.Holder.Nodes() {
+		assert.False(t, agents[0].config.Holder.IsDown(node))
+	}
+}
+
+func TestAgentRefutesSuspicion(t *testing.T) {
+	agents := startAgents(t, NewNetwork(), 0, "a", "b")
+	join(t, agents)
+	waitForRing(t, agents, []string{"a", "b"})
+
+	agents[0].mu.Lock()
+	agents[0].apply(Member{Name: "b", State: StateSuspect})
+	agents[0].mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		for _, member := range agents[0].Members() {
+			if member.Name == "b" {
+				return member.State == StateAlive && member.Incarnation > 0
+			}
+		}
+		return false
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestAgentsOverUDP(t *testing.T) {
+	agents := make([]*Agent, 0, 2)
+	for i := 0; i < 2; i++ {
+		// listening on all interfaces, the agents must advertise a reachable address
+		transport, err := ListenUDP(":0")
+		assert.Nil(t, err)
+		t.Cleanup(func() { _ = transport.Close() })
+
+		_, err = NewAgent(testConfig(transport))
+		assert.NotNil(t, err)
+
+		_, port, _ := net.SplitHostPort(transport.Addr())
+		config := testConfig(transport)
+		config.AdvertiseAddr = net.JoinHostPort("127.0.0.1", port)
+		agent, err := NewAgent(config)
+		assert.Nil(t, err)
+		t.Cleanup(agent.Stop)
+		agents = append(agents, agent)
+	}
+	join(t, agents)
+
+	expected := []string{agents[0].Name(), agents[1].Name()}
+	sort.Strings(expected)
+	waitForRing(t, agents, expected)
+}
+
+func TestOverrides(t *testing.T) {
+	alive := Member{Name: "a", Incarnation: 1, State: StateAlive}
+	suspect := Member{Name: "a", Incarnation: 1, State: StateSuspect}
+	dead := Member{Name: "a", Incarnation: 1, State: StateDead}
+
+	assert.True(t, overrides(suspect, alive))
+	assert.True(t, overrides(dead, alive))
+	assert.True(t, overrides(dead, suspect))
+	assert.False(t, overrides(alive, suspect))
+	assert.False(t, overrides(suspect, dead))
+	assert.False(t, overrides(dead, dead))
+
+	newer := Member{Name: "a", Incarnation: 2, State: StateAlive}
+	assert.True(t, overrides(newer, suspect))
+	assert.True(t, overrides(newer, dead))
+	assert.False(t, overrides(alive, newer))
+}
+
+func TestNewAgentRequiresTransportAndHolder(t *testing.T) {
+	_, err := NewAgent(Config{})
+	assert.NotNil(t, err)
+}
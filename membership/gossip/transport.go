@@ -0,0 +1,187 @@
+package gossip
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrClosed is returned when using a closed Transport.
+var ErrClosed = errors.New("gossip: transport closed")
+
+// Packet is a message received by a Transport.
+type Packet struct {
+	From string
+	Data []byte
+}
+
+// Transport carries the messages of an Agent. Like UDP, it may drop messages:
+// Send doesn't need to block or to report delivery failures.
+type Transport interface {
+	// Addr is the address the transport listens on, agents advertise it unless Config.AdvertiseAddr is set.
+	Addr() string
+	// Send sends data to the transport listening on addr.
+	Send(addr string, data []byte) error
+	// Packets returns the channel of received messages, it's closed by Close.
+	Packets() <-chan Packet
+	Close() error
+}
+
+// Network is an in-process network connecting memory transports, for tests and simulations.
+type Network struct {
+	mu         sync.RWMutex
+	transports map[string]*memoryTransport
+}
+
+// NewNetwork creates an empty in-process network.
+func NewNetwork() *Network {
+	return &Network{transports: make(map[string]*memoryTransport)}
+}
+
+// Transport creates a Transport listening on addr in the network.
+func (n *Network) Transport(addr string) (Transport, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if _, ok := n.transports[addr]; ok {
+		return nil, errors.New("gossip: address already in use: " + addr)
+	}
+	t := &memoryTransport{
+		network: n,
+		addr:    addr,
+		packets: make(chan Packet, 256),
+	}
+	n.transports[addr] = t
+	return t, nil
+}
+
+type memoryTransport struct {
+	network *Network
+	addr    string
+	packets chan Packet
+	mu      sync.RWMutex // mu guards closed and sending on packets
+	closed  bool
+}
+
+func (t *memoryTransport) Addr() string {
+	return t.addr
+}
+
+func (t *memoryTransport) Send(addr string, data []byte) error {
+	t.mu.RLock()
+	closed := t.closed
+	t.mu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+
+	t.network.mu.RLock()
+	to, ok := t.network.transports[addr]
+	t.network.mu.RUnlock()
+	if !ok {
+		// nobody listening, the message is lost
+		return nil
+	}
+
+	to.deliver(Packet{From: t.addr, Data: append([]byte(nil), data...)})
+	return nil
+}
+
+func (t *memoryTransport) deliver(packet Packet) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return
+	}
+	select {
+	case t.packets <- packet:
+	default:
+		// receiver is overloaded, drop like UDP would
+	}
+}
+
+func (t *memoryTransport) Packets() <-chan Packet {
+	return t.packets
+}
+
+func (t *memoryTransport) Close() error {
+	t.network.mu.Lock()
+	delete(t.network.transports, t.addr)
+	t.network.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.closed {
+		t.closed = true
+		close(t.packets)
+	}
+	return nil
+}
+
+// maxPacketSize is the largest UDP payload.
+const maxPacketSize = 65507
+
+// UDPTransport is a Transport over UDP.
+type UDPTransport struct {
+	conn    net.PacketConn
+	packets chan Packet
+}
+
+// ListenUDP creates a UDPTransport listening on addr, like "127.0.0.1:0".
+func ListenUDP(addr string) (*UDPTransport, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	t := &UDPTransport{
+		conn:    conn,
+		packets: make(chan Packet, 256),
+	}
+	go t.read()
+	return t, nil
+}
+
+func (t *UDPTransport) read() {
+	defer close(t.packets)
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, from, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		select {
+		case t.packets <- Packet{From: from.String(), Data: append([]byte(nil), buf[:n]...)}:
+		default:
+			// receiver is overloaded, drop the message
+		}
+	}
+}
+
+func (t *UDPTransport) Addr() string {
+	return t.conn.LocalAddr().String()
+}
+
+func (t *UDPTransport) Send(addr string, data []byte) error {
+	if len(data) > maxPacketSize {
+		return errors.New("gossip: message too large for UDP")
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	_, err = t.conn.WriteTo(data, udpAddr)
+	return err
+}
+
+func (t *UDPTransport) Packets() <-chan Packet {
+	return t.packets
+}
+
+func (t *UDPTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,16 @@
+// Package membership keeps the ring of a hashring.Holder in sync with an external list of nodes.
+package membership
+
+import "github.com/mugli/hashring"
+
+// NewNode creates a node from the name found by a provider. Providers use hashring.StringNode when it is nil.
+type NewNode func(name string) hashring.Node
+
+func (f NewNode) orDefault() NewNode {
+	if f != nil {
+		return f
+	}
+	return func(name string) hashring.Node {
+		return hashring.StringNode(name)
+	}
+}
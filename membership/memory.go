@@ -0,0 +1,201 @@
+package membership
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// MemoryRegistry is an in-memory Registry. It's meant for tests and as a reference implementation.
+type MemoryRegistry struct {
+	mu        sync.Mutex
+	entries   map[string][]byte
+	revision  int64
+	history   []RegistryEvent // history holds the events made after compacted
+	compacted int64
+	watches   map[*memoryWatch]bool
+}
+
+// NewMemoryRegistry creates an empty MemoryRegistry at revision 0.
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		entries: make(map[string][]byte),
+		watches: make(map[*memoryWatch]bool),
+	}
+}
+
+// Put registers or updates the entry name and returns the new revision.
+func (r *MemoryRegistry) Put(name string, value []byte) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[name] = value
+	return r.record(RegistryEvent{Type: EntryPut, Entry: Entry{Name: name, Value: value}})
+}
+
+// Delete removes the entry name and returns the new revision.
+// ok is false and the revision is unchanged if name isn't registered.
+func (r *MemoryRegistry) Delete(name string) (revision int64, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	value, ok := r.entries[name]
+	if !ok {
+		return r.revision, false
+	}
+	delete(r.entries, name)
+	return r.record(RegistryEvent{Type: EntryDeleted, Entry: Entry{Name: name, Value: value}}), true
+}
+
+// record requires r.mu to be locked
+func (r *MemoryRegistry) record(event RegistryEvent) int64 {
+	r.revision++
+	event.Revision = r.revision
+	r.history = append(r.history, event)
+	for watch := range r.watches {
+		watch.push(event)
+	}
+	return r.revision
+}
+
+// Compact forgets the changes made up to revision, watching from an older revision returns ErrCompacted.
+func (r *MemoryRegistry) Compact(revision int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if revision <= r.compacted {
+		return
+	}
+	if revision > r.revision {
+		revision = r.revision
+	}
+	r.history = r.history[revision-r.compacted:]
+	r.compacted = revision
+}
+
+// Disconnect closes all the watches, as if the connection to the registry was lost.
+func (r *MemoryRegistry) Disconnect() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for watch := range r.watches {
+		watch.close()
+		delete(r.watches, watch)
+	}
+}
+
+// List returns the entries sorted by name.
+func (r *MemoryRegistry) List(ctx context.Context) ([]Entry, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := make([]Entry, 0, len(r.entries))
+	for name, value := range r.entries {
+		entries = append(entries, Entry{Name: name, Value: value})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, r.revision, nil
+}
+
+// Watch streams the changes made after revision. Slow readers don't block writers,
+// events are queued until they are read.
+func (r *MemoryRegistry) Watch(ctx context.Context, revision int64) (<-chan RegistryEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if revision < r.compacted {
+		return nil, ErrCompacted
+	}
+
+	start := revision - r.compacted
+	if start > int64(len(r.history)) {
+		start = int64(len(r.history))
+	}
+	watch := newMemoryWatch()
+	for _, event := range r.history[start:] {
+		watch.push(event)
+	}
+	r.watches[watch] = true
+
+	events := make(chan RegistryEvent)
+	go func() {
+		defer close(events)
+		defer func() {
+			r.mu.Lock()
+			delete(r.watches, watch)
+			r.mu.Unlock()
+		}()
+		watch.forward(ctx, events)
+	}()
+	return events, nil
+}
+
+// memoryWatch is an unbounded queue of events read by a single goroutine.
+type memoryWatch struct {
+	mu     sync.Mutex
+	queue  []RegistryEvent
+	closed bool
+	notify chan struct{}
+}
+
+func newMemoryWatch() *memoryWatch {
+	return &memoryWatch{notify: make(chan struct{}, 1)}
+}
+
+func (w *memoryWatch) push(event RegistryEvent) {
+	w.mu.Lock()
+	w.queue = append(w.queue, event)
+	w.mu.Unlock()
+	w.signal()
+}
+
+func (w *memoryWatch) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	w.signal()
+}
+
+func (w *memoryWatch) signal() {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// forward sends the queued events to events until ctx is done or the watch is closed.
+func (w *memoryWatch) forward(ctx context.Context, events chan<- RegistryEvent) {
+	for {
+		w.mu.Lock()
+		if w.closed {
+			w.mu.Unlock()
+			return
+		}
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.notify:
+			}
+			continue
+		}
+		event := w.queue[0]
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case events <- event:
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package membership
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mugli/hashring"
+)
+
+// ErrCompacted is returned by Registry.Watch when the requested revision is no longer available.
+// Watchers recover from it by listing the registry again.
+var ErrCompacted = errors.New("membership: revision compacted")
+
+// Entry is a node registered in a Registry.
+type Entry struct {
+	Name  string
+	Value []byte
+}
+
+// RegistryEventType is the kind of change reported by Registry.Watch.
+type RegistryEventType int
+
+const (
+	EntryPut RegistryEventType = iota
+	EntryDeleted
+)
+
+// RegistryEvent is a change made to a Registry at Revision.
+type RegistryEvent struct {
+	Type     RegistryEventType
+	Entry    Entry
+	Revision int64
+}
+
+// Registry is a key-value store holding the nodes of a cluster, like etcd, Consul or ZooKeeper.
+// Every change gets a new, increasing revision.
+type Registry interface {
+	// List returns the registered entries and the revision they were read at.
+	List(ctx context.Context) (entries []Entry, revision int64, err error)
+	// Watch streams the changes made after revision, in order. The channel is closed when ctx is done
+	// or when the watch is lost. ErrCompacted is returned if the changes after revision are no longer available.
+	Watch(ctx context.Context, revision int64) (<-chan RegistryEvent, error)
+}
+
+// RegistryOptions configures a RegistryWatcher.
+type RegistryOptions struct {
+	RetryInterval time.Duration // RetryInterval is the delay before watching again after an error, 1s by default.
+	NewNode       NewNode       // NewNode creates the nodes from the entry names, hashring.StringNode by default.
+	OnError       func(error)   // OnError is called when Run fails to list or watch the registry.
+}
+
+// RegistryWatcher keeps the ring of a holder in sync with the entries of a Registry.
+// It lists the registry once, then applies the changes streamed by Watch. Lost watches are
+// resumed from the last applied revision, and the registry is listed again when that revision
+// has been compacted.
+type RegistryWatcher struct {
+	holder   *hashring.Holder
+	registry Registry
+	options  RegistryOptions
+
+	mu       sync.Mutex
+	names    map[string]bool // names are the entries of the registry at revision
+	revision int64
+}
+
+// NewRegistryWatcher creates a RegistryWatcher applying the entries of registry to holder.
+func NewRegistryWatcher(holder *hashring.Holder, registry Registry, options RegistryOptions) *RegistryWatcher {
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = time.Second
+	}
+	options.NewNode = options.NewNode.orDefault()
+	return &RegistryWatcher{
+		holder:   holder,
+		registry: registry,
+		options:  options,
+	}
+}
+
+// Revision returns the revision of the registry last applied to the holder, 0 before the first Resync.
+func (w *RegistryWatcher) Revision() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.revision
+}
+
+// Resync lists the registry and applies its entries to the holder.
+// Only the difference with the current ring is applied, in a single update.
+func (w *RegistryWatcher) Resync(ctx context.Context) error {
+	entries, revision, err := w.registry.List(ctx)
+	if err != nil {
+		return fmt.Errorf("membership: listing registry: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	names := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		names[entry.Name] = true
+	}
+	w.names = names
+	w.revision = revision
+	return w.apply()
+}
+
+// Run resyncs the registry, then watches it until ctx is done.
+// Errors are reported to OnError and retried every RetryInterval, the current ring is kept meanwhile.
+func (w *RegistryWatcher) Run(ctx context.Context) {
+	synced := false
+	for ctx.Err() == nil {
+		if !synced {
+			synced = w.report(ctx, w.Resync(ctx))
+		}
+		if synced {
+			err := w.watch(ctx)
+			if errors.Is(err, ErrCompacted) {
+				synced = false
+			}
+			w.report(ctx, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.options.RetryInterval):
+		}
+	}
+}
+
+// report sends err to OnError and reports whether it's nil.
+func (w *RegistryWatcher) report(ctx context.Context, err error) bool {
+	if err != nil && ctx.Err() == nil && w.options.OnError != nil {
+		w.options.OnError(err)
+	}
+	return err == nil
+}
+
+// watch applies the changes made after the current revision until the watch is lost.
+func (w *RegistryWatcher) watch(ctx context.Context) error {
+	events, err := w.registry.Watch(ctx, w.Revision())
+	if err != nil {
+		return fmt.Errorf("membership: watching registry: %w", err)
+	}
+
+	for {
+		event, ok := <-events
+		if !ok {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.New("membership: registry watch lost")
+		}
+
+		// apply the changes already received at once, rather than creating a ring per change
+		batch := []RegistryEvent{event}
+	drain:
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, event)
+			default:
+				break drain
+			}
+		}
+		if err := w.applyEvents(batch); err != nil {
+			w.report(ctx, err)
+		}
+	}
+}
+
+func (w *RegistryWatcher) applyEvents(events []RegistryEvent) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, event := range events {
+		if event.Revision <= w.revision {
+			continue
+		}
+		switch event.Type {
+		case EntryPut:
+			w.names[event.Entry.Name] = true
+		case EntryDeleted:
+			delete(w.names, event.Entry.Name)
+		}
+		w.revision = event.Revision
+	}
+	return w.apply()
+}
+
+// apply sets the nodes of the holder to the known entries.
+// An empty registry is rejected rather than emptying the ring.
+// apply requires w.mu to be locked
+func (w *RegistryWatcher) apply() error {
+	if len(w.names) == 0 {
+		return fmt.Errorf("membership: registry has no entries at revision %d", w.revision)
+	}
+
+	names := make([]string, 0, len(w.names))
+	for name := range w.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	nodes := make([]hashring.Node, 0, len(names))
+	for _, name := range names {
+		nodes = append(nodes, w.options.NewNode(name))
+	}
+	w.holder.SetNodes(nodes)
+	return nil
+}
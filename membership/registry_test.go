@@ -0,0 +1,112 @@
+package membership
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mugli/hashring"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRegistryWatch(t *testing.T) {
+	registry := NewMemoryRegistry()
+	registry.Put("a", nil)
+	registry.Put("b", []byte("data"))
+	registry.Delete("a")
+
+	entries, revision, err := registry.List(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), revision)
+	assert.Equal(t, []Entry{{Name: "b", Value: []byte("data")}}, entries)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := registry.Watch(ctx, 1)
+	assert.NoError(t, err)
+	registry.Put("c", nil)
+
+	for _, expected := range []RegistryEvent{
+		{Type: EntryPut, Entry: Entry{Name: "b", Value: []byte("data")}, Revision: 2},
+		{Type: EntryDeleted, Entry: Entry{Name: "a"}, Revision: 3},
+		{Type: EntryPut, Entry: Entry{Name: "c"}, Revision: 4},
+	} {
+		assert.Equal(t, expected, <-events)
+	}
+
+	registry.Compact(3)
+	_, err = registry.Watch(ctx, 2)
+	assert.ErrorIs(t, err, ErrCompacted)
+	_, err = registry.Watch(ctx, 3)
+	assert.NoError(t, err)
+
+	registry.Disconnect()
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestRegistryWatcherResync(t *testing.T) {
+	registry := NewMemoryRegistry()
+	holder := hashring.NewHolder(hashring.New([]hashring.Node{}))
+	watcher := NewRegistryWatcher(holder, registry, RegistryOptions{})
+
+	assert.Error(t, watcher.Resync(context.Background()), "an empty registry must be rejected")
+
+	registry.Put("a", nil)
+	registry.Put("b", nil)
+	assert.NoError(t, watcher.Resync(context.Background()))
+	assert.Equal(t, []string{"a", "b"}, nodeNames(holder.Ring()))
+	assert.Equal(t, int64(2), watcher.Revision())
+}
+
+func TestRegistryWatcherRun(t *testing.T) {
+	registry := NewMemoryRegistry()
+	registry.Put("a", nil)
+	holder := hashring.NewHolder(hashring.New([]hashring.Node{}))
+	errs := make(chan error, 16)
+	watcher := NewRegistryWatcher(holder, registry, RegistryOptions{
+		RetryInterval: 10 * time.Millisecond,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watcher.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	waitFor := func(expected ...string) {
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual(expected, nodeNames(holder.Ring()))
+		}, time.Second, 5*time.Millisecond)
+	}
+	waitFor("a")
+
+	registry.Put("b", nil)
+	registry.Put("c", nil)
+	waitFor("a", "b", "c")
+
+	// changes made while disconnected are replayed when the watch is resumed
+	registry.Disconnect()
+	registry.Delete("b")
+	waitFor("a", "c")
+
+	// a compacted revision makes the watcher list the registry again
+	registry.Disconnect()
+	registry.Put("d", nil)
+	registry.Delete("a")
+	registry.Compact(registry.Put("e", nil))
+	waitFor("c", "d", "e")
+	assert.Equal(t, int64(7), watcher.Revision())
+	assert.NotEmpty(t, errs)
+}
@@ -0,0 +1,133 @@
+package hashring
+
+import "encoding/json"
+
+// TaskOp is the kind of work described by a Task.
+type TaskOp string
+
+const (
+	// CopyRange copies the keys of a range from Source to Target.
+	CopyRange TaskOp = "copy"
+	// DropRange deletes the keys of a range from Target.
+	DropRange TaskOp = "drop"
+)
+
+// Task is a single step of a migration Plan.
+type Task struct {
+	Op       TaskOp
+	Range    Range
+	Source   Node // Source is the node to copy from, nil for DropRange tasks.
+	Target   Node // Target is the node receiving the copy, or the node dropping the range.
+	Fraction float64
+}
+
+// MarshalJSON encodes the nodes of a Task by their String() representation,
+// so that a Plan can be reviewed whatever the concrete Node type is.
+func (t Task) MarshalJSON() ([]byte, error) {
+	type task struct {
+		Op       TaskOp  `json:"op"`
+		Start    HashKey `json:"start"`
+		End      HashKey `json:"end"`
+		Source   string  `json:"source,omitempty"`
+		Target   string  `json:"target"`
+		Fraction float64 `json:"fraction"`
+	}
+
+	out := task{
+		Op:       t.Op,
+		Start:    t.Range.Start,
+		End:      t.Range.End,
+		Target:   t.Target.String(),
+		Fraction: t.Fraction,
+	}
+	if t.Source != nil {
+		out.Source = t.Source.String()
+	}
+	return json.Marshal(out)
+}
+
+// Plan is an ordered list of tasks migrating data from one ring to another.
+// Tasks must be executed in order: every copy comes before the first drop,
+// so each key keeps at least one readable replica during the migration.
+type Plan struct {
+	Replicas int    `json:"replicas"`
+	Tasks    []Task `json:"tasks"`
+}
+
+// NewPlan computes the tasks needed to move from old to new when every key is stored
+// on numberOfReplicas nodes, as returned by GetNodesForReplicas.
+// Only nodes joining the replica set of a range receive a copy, and adjacent ranges
+// transferred between the same nodes are merged into a single task.
+// Both rings must be created with the same HashFunc.
+func NewPlan(old, new *HashRing, numberOfReplicas int) *Plan {
+	copies := make([]Task, 0)
+	drops := make([]Task, 0)
+
+	for _, change := range DiffReplicas(old, new, numberOfReplicas) {
+		source := planSource(change.FromReplicas, change.ToReplicas)
+		if source != nil {
+			for _, target := range change.ToReplicas {
+				if !containsNode(change.FromReplicas, target) {
+					copies = appendTask(copies, Task{Op: CopyRange, Range: change.Range, Source: source, Target: target})
+				}
+			}
+		}
+		for _, target := range change.FromReplicas {
+			if !containsNode(change.ToReplicas, target) {
+				drops = appendTask(drops, Task{Op: DropRange, Range: change.Range, Target: target})
+			}
+		}
+	}
+
+	tasks := append(copies, drops...)
+	for i := range tasks {
+		tasks[i].Fraction = tasks[i].Range.Fraction()
+	}
+	return &Plan{
+		Replicas: numberOfReplicas,
+		Tasks:    tasks,
+	}
+}
+
+// planSource picks the node to copy a range from. Nodes staying in the replica set are preferred,
+// they are not going to drop the range, then nodes are taken in replica order.
+func planSource(from, to []Node) Node {
+	for _, node := range from {
+		if containsNode(to, node) {
+			return node
+		}
+	}
+	if len(from) > 0 {
+		return from[0]
+	}
+	return nil
+}
+
+// appendTask adds task to tasks, or extends an earlier task between the same nodes that ends where task starts.
+func appendTask(tasks []Task, task Task) []Task {
+	for i := len(tasks) - 1; i >= 0; i-- {
+		t := &tasks[i]
+		if t.Op == task.Op && sameNode(t.Source, task.Source) && sameNode(t.Target, task.Target) &&
+			equalKeys(t.Range.End, task.Range.Start) {
+			t.Range.End = task.Range.End
+			return tasks
+		}
+	}
+	return append(tasks, task)
+}
+
+func sameNode(a, b Node) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.String() == b.String()
+}
+
+func containsNode(nodes []Node, node Node) bool {
+	for _, n := range nodes {
+		if sameNode(n, node) {
+			return true
+		}
+	}
+	return false
+}
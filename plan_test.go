@@ -0,0 +1,111 @@
+package hashring
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertPlanExecution replays plan over sample keys and checks that every key stays readable
+// and ends up exactly on the replicas of the new ring.
+func assertPlanExecution(t *testing.T, old, new *HashRing, plan *Plan) {
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("key%d", i)
+		hashKey := new.GenKey(key)
+
+		holders := map[string]bool{}
+		oldNodes, _ := old.GetNodesForReplicas(key, plan.Replicas)
+		for _, node := range oldNodes {
+			holders[node.String()] = true
+		}
+
+		for _, task := range plan.Tasks {
+			if !task.Range.Contains(hashKey) {
+				continue
+			}
+			switch task.Op {
+			case CopyRange:
+				assert.True(t, holders[task.Source.String()], "%s: copy from %s which doesn't hold the key", key, task.Source)
+				holders[task.Target.String()] = true
+			case DropRange:
+				delete(holders, task.Target.String())
+			}
+			if !assert.NotEmpty(t, holders, "%s: no readable replica left", key) {
+				return
+			}
+		}
+
+		expected := map[string]bool{}
+		newNodes, _ := new.GetNodesForReplicas(key, plan.Replicas)
+		for _, node := range newNodes {
+			expected[node.String()] = true
+		}
+		assert.Equal(t, expected, holders, key)
+	}
+}
+
+func TestPlanAddNode(t *testing.T) {
+	old := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+	new := old.AddNode(myNode("d"))
+	plan := NewPlan(old, new, 2)
+
+	dropping := false
+	for _, task := range plan.Tasks {
+		if task.Op == CopyRange {
+			assert.False(t, dropping, "copy after drop")
+			assert.Equal(t, myNode("d"), task.Target)
+		} else {
+			dropping = true
+			assert.Nil(t, task.Source)
+		}
+	}
+	assertPlanExecution(t, old, new, plan)
+}
+
+func TestPlanRemoveAndAddNodes(t *testing.T) {
+	old := New(stringSliceToNodeSlice([]string{"a", "b", "c", "d", "e"}))
+	new := old.RemoveNode(myNode("b")).RemoveNode(myNode("d")).AddNode(myNode("f"))
+
+	for replicas := 1; replicas <= 3; replicas++ {
+		assertPlanExecution(t, old, new, NewPlan(old, new, replicas))
+	}
+}
+
+func TestPlanSameRing(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+
+	assert.Empty(t, NewPlan(ring, ring, 2).Tasks)
+}
+
+func TestPlanJSON(t *testing.T) {
+	old := New(stringSliceToNodeSlice([]string{"a", "b"}))
+	new := old.RemoveNode(myNode("b"))
+
+	data, err := json.Marshal(NewPlan(old, new, 1))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var decoded struct {
+		Replicas int
+		Tasks    []struct {
+			Op     string
+			Source string
+			Target string
+		}
+	}
+	if assert.NoError(t, json.Unmarshal(data, &decoded)) {
+		assert.Equal(t, 1, decoded.Replicas)
+		for _, task := range decoded.Tasks {
+			if task.Op == "copy" {
+				assert.Equal(t, "b", task.Source)
+				assert.Equal(t, "a", task.Target)
+			} else {
+				assert.Equal(t, "drop", task.Op)
+				assert.Equal(t, "b", task.Target)
+			}
+		}
+	}
+}
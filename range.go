@@ -0,0 +1,90 @@
+package hashring
+
+// Range is a half-open span [Start, End) of the hash ring.
+// A Range whose End isn't greater than its Start wraps around the top of the ring,
+// a Range with equal Start and End covers the whole ring.
+type Range struct {
+	Start HashKey
+	End   HashKey
+}
+
+// Contains reports whether key falls into the Range.
+func (r Range) Contains(key HashKey) bool {
+	if r.Start.Less(r.End) {
+		return !key.Less(r.Start) && key.Less(r.End)
+	}
+	// wrapping range
+	return !key.Less(r.Start) || key.Less(r.End)
+}
+
+// Fraction returns the portion of the keyspace covered by the Range.
+// It's always 0 if the keys of the range don't implement PositionedHashKey.
+func (r Range) Fraction() float64 {
+	start, ok := r.Start.(PositionedHashKey)
+	if !ok {
+		return 0
+	}
+	end, ok := r.End.(PositionedHashKey)
+	if !ok {
+		return 0
+	}
+
+	if equalKeys(r.Start, r.End) {
+		return 1
+	}
+	fraction := end.Position() - start.Position()
+	if r.End.Less(r.Start) {
+		fraction += 1
+	}
+	if fraction < 0 {
+		// positions are approximate, keys too close to each other can end up reversed
+		return 0
+	}
+	return fraction
+}
+
+func equalKeys(a, b HashKey) bool {
+	return !a.Less(b) && !b.Less(a)
+}
+
+// uniqueKeys returns sortedKeys without the duplicates introduced by duplicate nodes.
+// uniqueKeys requires RLock(), make sure the caller is doing it
+func (h *HashRing) uniqueKeys() []HashKey {
+	keys := make([]HashKey, 0, len(h.sortedKeys))
+	for _, key := range h.sortedKeys {
+		if len(keys) > 0 && equalKeys(keys[len(keys)-1], key) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// mergeKeys merges two sorted lists of keys into one sorted list without duplicates.
+func mergeKeys(a, b []HashKey) []HashKey {
+	merged := make([]HashKey, 0, len(a)+len(b))
+	push := func(key HashKey) {
+		if len(merged) > 0 && equalKeys(merged[len(merged)-1], key) {
+			return
+		}
+		merged = append(merged, key)
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if b[j].Less(a[i]) {
+			push(b[j])
+			j++
+		} else {
+			push(a[i])
+			i++
+		}
+	}
+	for ; i < len(a); i++ {
+		push(a[i])
+	}
+	for ; j < len(b); j++ {
+		push(b[j])
+	}
+	return merged
+}
@@ -0,0 +1,337 @@
+// Package shardmap is a concurrent in-memory map split into shards assigned by a hashring,
+// to spread lock contention. Shards can be added and removed at runtime: only the keys whose shard
+// changes are migrated, and reads and writes carry on during the migration.
+package shardmap
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mugli/hashring"
+)
+
+type shard struct {
+	mu    sync.RWMutex
+	items map[string]interface{}
+}
+
+func newShard() *shard {
+	return &shard{items: make(map[string]interface{})}
+}
+
+// topology is the assignment of keys to shards. While resharding, keys are moving from the shards
+// of old to the shards of ring, a key is either in its shard in ring or, not migrated yet, in its shard in old.
+type topology struct {
+	ring   *hashring.HashRing
+	old    *hashring.HashRing // old is nil when no resharding is in progress
+	shards map[string]*shard  // shards holds the shards of ring and old
+}
+
+// ShardedMap is a map from strings to arbitrary values, safe for concurrent use.
+type ShardedMap struct {
+	mu       sync.RWMutex // mu guards topology, which is replaced rather than modified
+	topology *topology
+
+	reshardMu sync.Mutex // reshardMu serializes the resharding operations
+}
+
+// New creates a ShardedMap with the given shard names. At least one shard is required.
+func New(names ...string) *ShardedMap {
+	if len(names) == 0 {
+		panic("shardmap: at least one shard is required")
+	}
+
+	nodes := make([]hashring.Node, 0, len(names))
+	shards := make(map[string]*shard, len(names))
+	for _, name := range names {
+		if _, ok := shards[name]; ok {
+			continue
+		}
+		nodes = append(nodes, hashring.StringNode(name))
+		shards[name] = newShard()
+	}
+	return &ShardedMap{
+		topology: &topology{
+			ring:   hashring.New(nodes),
+			shards: shards,
+		},
+	}
+}
+
+// locate returns the shards of key in the current topology. The topology is read locked until unlock is called,
+// so that a resharding can't start or finish in the middle of an operation.
+func (m *ShardedMap) locate(key string, write bool) (owner, previous *shard, unlock func()) {
+	m.mu.RLock()
+	owner, previous = m.topology.locate(key)
+	unlockShards := lockPair(owner, previous, write)
+	return owner, previous, func() {
+		unlockShards()
+		m.mu.RUnlock()
+	}
+}
+
+func (m *ShardedMap) current() *topology {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.topology
+}
+
+// locate returns the shard owning key, and the shard it might still be in while resharding,
+// nil if it's the same shard.
+func (t *topology) locate(key string) (owner *shard, previous *shard) {
+	// the rings of a ShardedMap are never empty nor marked down, GetNode always finds a node
+	node, _ := t.ring.GetNode(key)
+	owner = t.shards[node.String()]
+	if t.old != nil {
+		if oldNode, _ := t.old.GetNode(key); oldNode.String() != node.String() {
+			previous = t.shards[oldNode.String()]
+		}
+	}
+	return owner, previous
+}
+
+// lockPair locks owner and previous, previous is locked first to match the order of the migration.
+func lockPair(owner, previous *shard, write bool) (unlock func()) {
+	lock := func(s *shard) {
+		if write {
+			s.mu.Lock()
+		} else {
+			s.mu.RLock()
+		}
+	}
+	unlockShard := func(s *shard) {
+		if write {
+			s.mu.Unlock()
+		} else {
+			s.mu.RUnlock()
+		}
+	}
+
+	if previous == nil {
+		lock(owner)
+		return func() { unlockShard(owner) }
+	}
+	lock(previous)
+	lock(owner)
+	return func() {
+		unlockShard(owner)
+		unlockShard(previous)
+	}
+}
+
+// Get returns the value of key.
+func (m *ShardedMap) Get(key string) (value interface{}, ok bool) {
+	owner, previous, unlock := m.locate(key, false)
+	defer unlock()
+
+	if value, ok = owner.items[key]; ok || previous == nil {
+		return value, ok
+	}
+	value, ok = previous.items[key]
+	return value, ok
+}
+
+// Set sets the value of key.
+func (m *ShardedMap) Set(key string, value interface{}) {
+	owner, previous, unlock := m.locate(key, true)
+	defer unlock()
+
+	owner.items[key] = value
+	if previous != nil {
+		delete(previous.items, key)
+	}
+}
+
+// Delete removes key.
+func (m *ShardedMap) Delete(key string) {
+	owner, previous, unlock := m.locate(key, true)
+	defer unlock()
+
+	delete(owner.items, key)
+	if previous != nil {
+		delete(previous.items, key)
+	}
+}
+
+// Len returns the number of keys. It's approximate while resharding, keys migrated meanwhile can be counted twice or missed.
+func (m *ShardedMap) Len() int {
+	n := 0
+	for _, s := range m.current().shards {
+		s.mu.RLock()
+		n += len(s.items)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// Range calls f for every key until f returns false. Shards are visited one at a time,
+// so changes made meanwhile may or may not be seen, and keys migrated meanwhile can be visited twice or missed.
+// f must not modify the map.
+func (m *ShardedMap) Range(f func(key string, value interface{}) bool) {
+	for _, s := range m.current().shards {
+		s.mu.RLock()
+		for key, value := range s.items {
+			if !f(key, value) {
+				s.mu.RUnlock()
+				return
+			}
+		}
+		s.mu.RUnlock()
+	}
+}
+
+// Shards returns the names of the shards, sorted.
+func (m *ShardedMap) Shards() []string {
+	nodes := m.current().ring.Nodes()
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.String())
+	}
+	return names
+}
+
+// ShardOf returns the name of the shard owning key.
+func (m *ShardedMap) ShardOf(key string) string {
+	// the ring is never empty nor marked down
+	node, _ := m.current().ring.GetNode(key)
+	return node.String()
+}
+
+// ShardLens returns the number of keys of every shard by name.
+func (m *ShardedMap) ShardLens() map[string]int {
+	lens := make(map[string]int)
+	for name, s := range m.current().shards {
+		s.mu.RLock()
+		lens[name] = len(s.items)
+		s.mu.RUnlock()
+	}
+	return lens
+}
+
+// AddShard adds a shard and migrates the keys it now owns. It returns the number of keys moved.
+// Adding an existing shard does nothing.
+func (m *ShardedMap) AddShard(name string) int {
+	m.reshardMu.Lock()
+	defer m.reshardMu.Unlock()
+
+	ring := m.current().ring
+	return m.reshard(ring.AddNode(hashring.StringNode(name)), name)
+}
+
+// RemoveShard removes a shard after migrating its keys to the remaining shards. It returns the number of keys moved.
+func (m *ShardedMap) RemoveShard(name string) (int, error) {
+	m.reshardMu.Lock()
+	defer m.reshardMu.Unlock()
+
+	ring := m.current().ring
+	if _, ok := m.current().shards[name]; !ok {
+		return 0, fmt.Errorf("shardmap: unknown shard %q", name)
+	}
+	if ring.Size() == 1 {
+		return 0, errors.New("shardmap: the last shard can't be removed")
+	}
+	return m.reshard(ring.RemoveNode(m.node(name)), ""), nil
+}
+
+// node returns the node of the shard name in the current ring.
+func (m *ShardedMap) node(name string) hashring.Node {
+	for _, node := range m.current().ring.Nodes() {
+		if node.String() == name {
+			return node
+		}
+	}
+	return hashring.StringNode(name)
+}
+
+// reshard moves to ring, creating the shard added if not empty. The keys in the ranges changing owner
+// are migrated one at a time, then the shards no longer in ring are dropped.
+// reshard requires reshardMu, make sure the caller is doing it
+func (m *ShardedMap) reshard(ring *hashring.HashRing, added string) int {
+	current := m.current()
+	if ring == current.ring {
+		return 0
+	}
+
+	shards := make(map[string]*shard, len(current.shards)+1)
+	for name, s := range current.shards {
+		shards[name] = s
+	}
+	if added != "" {
+		shards[added] = newShard()
+	}
+	m.mu.Lock()
+	m.topology = &topology{ring: ring, old: current.ring, shards: shards}
+	m.mu.Unlock()
+
+	// only the shards losing ranges are scanned, and only the keys in those ranges are moved
+	changes := hashring.Diff(current.ring, ring)
+	bySource := make(map[string][]hashring.RangeChange)
+	for _, change := range changes {
+		bySource[change.From.String()] = append(bySource[change.From.String()], change)
+	}
+	sources := make([]string, 0, len(bySource))
+	for name := range bySource {
+		sources = append(sources, name)
+	}
+	sort.Strings(sources)
+
+	moved := 0
+	for _, name := range sources {
+		moved += migrate(ring, shards, name, bySource[name])
+	}
+
+	final := make(map[string]*shard, ring.Size())
+	for _, node := range ring.Nodes() {
+		final[node.String()] = shards[node.String()]
+	}
+	m.mu.Lock()
+	m.topology = &topology{ring: ring, shards: final}
+	m.mu.Unlock()
+	return moved
+}
+
+// migrate moves the keys of the shard source falling into changes to their new shard.
+func migrate(ring *hashring.HashRing, shards map[string]*shard, source string, changes []hashring.RangeChange) int {
+	src := shards[source]
+	src.mu.RLock()
+	keys := make([]string, 0, len(src.items))
+	for key := range src.items {
+		keys = append(keys, key)
+	}
+	src.mu.RUnlock()
+
+	moved := 0
+	for _, key := range keys {
+		hashKey := ring.GenKey(key)
+		for _, change := range changes {
+			if !change.Contains(hashKey) {
+				continue
+			}
+			if moveKey(key, src, shards[change.To.String()]) {
+				moved++
+			}
+			break
+		}
+	}
+	return moved
+}
+
+// moveKey moves key from src to dst, unless it has been deleted or already written to dst meanwhile.
+func moveKey(key string, src, dst *shard) bool {
+	unlock := lockPair(dst, src, true)
+	defer unlock()
+
+	value, ok := src.items[key]
+	if !ok {
+		return false
+	}
+	delete(src.items, key)
+	if _, ok := dst.items[key]; ok {
+		return false
+	}
+	dst.items[key] = value
+	return true
+}
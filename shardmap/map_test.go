@@ -0,0 +1,157 @@
+package shardmap
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fill(m *ShardedMap, n int) {
+	for i := 0; i < n; i++ {
+		m.Set(fmt.Sprintf("key%d", i), i)
+	}
+}
+
+func TestShardedMap(t *testing.T) {
+	m := New("a", "b", "c", "a")
+	assert.Equal(t, []string{"a", "b", "c"}, m.Shards())
+
+	fill(m, 100)
+	assert.Equal(t, 100, m.Len())
+	value, ok := m.Get("key42")
+	assert.True(t, ok)
+	assert.Equal(t, 42, value)
+
+	m.Delete("key42")
+	_, ok = m.Get("key42")
+	assert.False(t, ok)
+	assert.Equal(t, 99, m.Len())
+
+	lens := m.ShardLens()
+	assert.Equal(t, 99, lens["a"]+lens["b"]+lens["c"])
+	for _, n := range lens {
+		assert.Greater(t, n, 0)
+	}
+
+	seen := 0
+	m.Range(func(key string, value interface{}) bool {
+		seen++
+		return seen < 10
+	})
+	assert.Equal(t, 10, seen)
+
+	assert.Panics(t, func() { New() })
+}
+
+func TestAddShardMovesOnlyChangedKeys(t *testing.T) {
+	m := New("a", "b", "c")
+	fill(m, 1000)
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		before[key] = m.ShardOf(key)
+	}
+
+	moved := m.AddShard("d")
+	assert.Equal(t, []string{"a", "b", "c", "d"}, m.Shards())
+	assert.Equal(t, 1000, m.Len())
+
+	changed := 0
+	for key, shard := range before {
+		if m.ShardOf(key) != shard {
+			changed++
+			assert.Equal(t, "d", m.ShardOf(key), "keys only move to the new shard")
+		}
+		value, ok := m.Get(key)
+		assert.True(t, ok)
+		assert.Equal(t, key, fmt.Sprintf("key%d", value))
+	}
+	assert.Equal(t, changed, moved)
+	assert.Equal(t, changed, m.ShardLens()["d"])
+
+	assert.Equal(t, 0, m.AddShard("d"))
+}
+
+func TestRemoveShard(t *testing.T) {
+	m := New("a", "b", "c")
+	fill(m, 1000)
+	lens := m.ShardLens()
+
+	moved, err := m.RemoveShard("b")
+	assert.NoError(t, err)
+	assert.Equal(t, lens["b"], moved)
+	assert.Equal(t, []string{"a", "c"}, m.Shards())
+	assert.Equal(t, 1000, m.Len())
+	_, ok := m.ShardLens()["b"]
+	assert.False(t, ok)
+	for i := 0; i < 1000; i++ {
+		value, ok := m.Get(fmt.Sprintf("key%d", i))
+		assert.True(t, ok)
+		assert.Equal(t, i, value)
+	}
+
+	_, err = m.RemoveShard("b")
+	assert.Error(t, err)
+	_, err = m.RemoveShard("a")
+	assert.NoError(t, err)
+	_, err = m.RemoveShard("c")
+	assert.Error(t, err, "the last shard can't be removed")
+}
+
+func TestReshardingWithConcurrentWrites(t *testing.T) {
+	m := New("a", "b")
+	fill(m, 2000)
+
+	// every writer owns a set of keys and writes increasing values, no write may be lost
+	const writers = 8
+	last := make([]map[string]int, writers)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		w := w
+		last[w] = make(map[string]int)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				key := fmt.Sprintf("key%d", (n*writers+w)%2000)
+				switch n % 3 {
+				case 0, 1:
+					m.Set(key, n)
+					last[w][key] = n
+				default:
+					m.Delete(key)
+					last[w][key] = -1
+				}
+				m.Get(fmt.Sprintf("key%d", n%2000))
+			}
+		}()
+	}
+
+	m.AddShard("c")
+	m.AddShard("d")
+	_, err := m.RemoveShard("a")
+	assert.NoError(t, err)
+	m.AddShard("e")
+	close(stop)
+	wg.Wait()
+
+	for w := 0; w < writers; w++ {
+		for key, expected := range last[w] {
+			value, ok := m.Get(key)
+			if expected == -1 {
+				assert.False(t, ok, key)
+			} else {
+				assert.Equal(t, expected, value, key)
+			}
+		}
+	}
+	assert.Equal(t, []string{"b", "c", "d", "e"}, m.Shards())
+}
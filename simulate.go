@@ -0,0 +1,171 @@
+package hashring
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrEmptyRing is returned by functions which need at least one node in the ring.
+var ErrEmptyRing = errors.New("hashring: ring is empty")
+
+// KeySource yields the keys replayed by Simulate, one at a time.
+// NextKey returns io.EOF once the source is exhausted.
+type KeySource interface {
+	NextKey() (string, error)
+}
+
+// KeySourceFunc adapts a generator function to a KeySource.
+type KeySourceFunc func() (string, error)
+
+func (f KeySourceFunc) NextKey() (string, error) {
+	return f()
+}
+
+type lineKeySource struct {
+	scanner *bufio.Scanner
+}
+
+// NewLineKeySource returns a KeySource reading newline-delimited keys from r, like a key log.
+// Surrounding whitespace is trimmed and empty lines are skipped.
+func NewLineKeySource(r io.Reader) KeySource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &lineKeySource{scanner: scanner}
+}
+
+func (s *lineKeySource) NextKey() (string, error) {
+	for s.scanner.Scan() {
+		if key := strings.TrimSpace(s.scanner.Text()); key != "" {
+			return key, nil
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+// SimulationOptions configures Simulate.
+type SimulationOptions struct {
+	HotKeys int       // HotKeys is the number of most requested keys reported per node.
+	Compare *HashRing // Compare is an optional second ring, keys owned by another node in it are reported as moved.
+}
+
+// KeyCount is the number of times a key showed up in a KeySource.
+type KeyCount struct {
+	Key   string
+	Count int
+}
+
+// NodeLoad is the share of a simulated key stream routed to a node.
+type NodeLoad struct {
+	Node       Node
+	Count      int        // Count is the number of keys routed to the node, repetitions included.
+	UniqueKeys int        // UniqueKeys is the number of distinct keys routed to the node.
+	HotKeys    []KeyCount // HotKeys are the most requested keys of the node, most requested first.
+	Moved      int        // Moved is the number of keys, repetitions included, owned by another node in the compared ring.
+}
+
+// Simulation is the result of replaying a key stream against a ring.
+type Simulation struct {
+	Keys          int        // Keys is the number of keys read, repetitions included.
+	UniqueKeys    int        // UniqueKeys is the number of distinct keys read.
+	Nodes         []NodeLoad // Nodes are sorted by their String() representation.
+	MovedKeys     int        // MovedKeys is the number of distinct keys owned by another node in the compared ring.
+	MovedRequests int        // MovedRequests is the number of keys, repetitions included, owned by another node in the compared ring.
+	Unrouted      int        // Unrouted is the number of keys, repetitions included, without any node up to route them to.
+}
+
+// Simulate routes every key of keys through ring and reports how the load is spread over the nodes.
+// Distinct keys are kept in memory to count repetitions. Keys can't be routed when every node is marked down,
+// they are only counted in Unrouted.
+func Simulate(ring *HashRing, keys KeySource, opts SimulationOptions) (*Simulation, error) {
+	nodes := ring.Nodes()
+	if len(nodes) == 0 {
+		return nil, ErrEmptyRing
+	}
+
+	loads := make([]NodeLoad, len(nodes))
+	index := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		loads[i].Node = node
+		index[node.String()] = i
+	}
+
+	type keyStats struct {
+		count int
+		node  int
+		moved bool
+	}
+	seen := make(map[string]*keyStats)
+	simulation := &Simulation{}
+
+	for {
+		key, err := keys.NextKey()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		stats, ok := seen[key]
+		if !ok {
+			stats = &keyStats{node: -1}
+			if node, ok := ring.GetNode(key); ok {
+				stats.node = index[node.String()]
+				if opts.Compare != nil {
+					other, ok := opts.Compare.GetNode(key)
+					stats.moved = !ok || other.String() != node.String()
+				}
+				loads[stats.node].UniqueKeys++
+				if stats.moved {
+					simulation.MovedKeys++
+				}
+			}
+			seen[key] = stats
+		}
+
+		if stats.node < 0 {
+			stats.count++
+			simulation.Keys++
+			simulation.Unrouted++
+			continue
+		}
+		stats.count++
+		simulation.Keys++
+		loads[stats.node].Count++
+		if stats.moved {
+			loads[stats.node].Moved++
+			simulation.MovedRequests++
+		}
+	}
+	simulation.UniqueKeys = len(seen)
+
+	if opts.HotKeys > 0 {
+		for key, stats := range seen {
+			if stats.node < 0 {
+				continue
+			}
+			loads[stats.node].HotKeys = append(loads[stats.node].HotKeys, KeyCount{Key: key, Count: stats.count})
+		}
+		for i := range loads {
+			hotKeys := loads[i].HotKeys
+			sort.Slice(hotKeys, func(a, b int) bool {
+				if hotKeys[a].Count != hotKeys[b].Count {
+					return hotKeys[a].Count > hotKeys[b].Count
+				}
+				return hotKeys[a].Key < hotKeys[b].Key
+			})
+			if len(hotKeys) > opts.HotKeys {
+				loads[i].HotKeys = hotKeys[:opts.HotKeys]
+			}
+		}
+	}
+
+	simulation.Nodes = loads
+	return simulation, nil
+}
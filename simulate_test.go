@@ -0,0 +1,106 @@
+package hashring
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulate(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+	keys := "test\ntest\n\ntest1\n  test3  \ntest\naaaa\ntest3\n"
+
+	simulation, err := Simulate(ring, NewLineKeySource(strings.NewReader(keys)), SimulationOptions{HotKeys: 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 7, simulation.Keys)
+	assert.Equal(t, 4, simulation.UniqueKeys)
+	assert.Equal(t, 0, simulation.MovedKeys)
+	assert.Equal(t, []NodeLoad{
+		{Node: myNode("a"), Count: 3, UniqueKeys: 1, HotKeys: []KeyCount{{"test", 3}}},
+		{Node: myNode("b"), Count: 1, UniqueKeys: 1, HotKeys: []KeyCount{{"test1", 1}}},
+		{Node: myNode("c"), Count: 3, UniqueKeys: 2, HotKeys: []KeyCount{{"test3", 2}}},
+	}, simulation.Nodes)
+}
+
+func TestSimulateCompare(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+	compare := ring.AddNode(myNode("d"))
+
+	i := 0
+	generator := KeySourceFunc(func() (string, error) {
+		if i == 1000 {
+			return "", io.EOF
+		}
+		i++
+		return fmt.Sprintf("key%d", i%100), nil
+	})
+
+	simulation, err := Simulate(ring, generator, SimulationOptions{Compare: compare})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	moved := 0
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		before, _ := ring.GetNode(key)
+		after, _ := compare.GetNode(key)
+		if before != after {
+			moved++
+		}
+	}
+	assert.Equal(t, 100, simulation.UniqueKeys)
+	assert.Equal(t, moved, simulation.MovedKeys)
+	assert.Equal(t, moved*10, simulation.MovedRequests)
+
+	perNode := 0
+	for _, load := range simulation.Nodes {
+		assert.Nil(t, load.HotKeys)
+		perNode += load.Moved
+	}
+	assert.Equal(t, simulation.MovedRequests, perNode)
+}
+
+func TestSimulateDownNodes(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b"}))
+	ring.MarkDown(myNode("a"))
+	ring.MarkDown(myNode("b"))
+	keys := "test\ntest\ntest1\n"
+
+	simulation, err := Simulate(ring, NewLineKeySource(strings.NewReader(keys)), SimulationOptions{HotKeys: 1, Compare: ring.RemoveNode(myNode("b"))})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 3, simulation.Keys)
+	assert.Equal(t, 2, simulation.UniqueKeys)
+	assert.Equal(t, 3, simulation.Unrouted)
+	assert.Equal(t, 0, simulation.MovedKeys)
+	for _, load := range simulation.Nodes {
+		assert.Equal(t, 0, load.Count)
+		assert.Empty(t, load.HotKeys)
+	}
+
+	ring.MarkUp(myNode("a"))
+	simulation, err = Simulate(ring, NewLineKeySource(strings.NewReader(keys)), SimulationOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, simulation.Unrouted)
+		assert.Equal(t, 3, simulation.Nodes[0].Count)
+	}
+}
+
+func TestSimulateErrors(t *testing.T) {
+	_, err := Simulate(New(stringSliceToNodeSlice([]string{})), NewLineKeySource(strings.NewReader("a")), SimulationOptions{})
+	assert.Equal(t, ErrEmptyRing, err)
+
+	failure := fmt.Errorf("broken source")
+	_, err = Simulate(New(stringSliceToNodeSlice([]string{"a"})), KeySourceFunc(func() (string, error) {
+		return "", failure
+	}), SimulationOptions{})
+	assert.Equal(t, failure, err)
+}
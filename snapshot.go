@@ -0,0 +1,337 @@
+package hashring
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SnapshotVersion is the version of the Snapshot format written by HashRing.Snapshot.
+const SnapshotVersion = 1
+
+// snapshotMagic starts every binary encoded Snapshot.
+var snapshotMagic = []byte("HRSN")
+
+// ErrSnapshotMismatch is returned by Restore when the restored ring doesn't hash its nodes
+// to the tokens recorded in the snapshot, so it wouldn't produce identical lookups.
+var ErrSnapshotMismatch = errors.New("hashring: restored ring doesn't match snapshot")
+
+// NodeEncoder serializes the data of a custom Node type so that it can be restored with a NodeDecoder.
+type NodeEncoder func(node Node) ([]byte, error)
+
+// NodeDecoder recreates a Node from its String() representation and the data written by a NodeEncoder.
+type NodeDecoder func(name string, data []byte) (Node, error)
+
+// Snapshot is a serializable copy of a HashRing. It can be encoded with encoding/json or MarshalBinary.
+type Snapshot struct {
+	Version      int            `json:"version"`
+	Hash         string         `json:"hash"`                   // Hash is the name of the hash function, see RegisterHash.
+	KeyExtractor string         `json:"keyExtractor,omitempty"` // KeyExtractor is the name of the key extractor, see RegisterKeyExtractor.
+	VirtualNodes int            `json:"virtualNodes"`           // VirtualNodes is the number of tokens per node, see WithVirtualNodes.
+	Epoch        uint64         `json:"epoch"`                  // Epoch is the epoch of the ring.
+	Nodes        []SnapshotNode `json:"nodes"`
+}
+
+// SnapshotNode is a node of a Snapshot, its lifecycle state and the tokens it owns on the ring.
+type SnapshotNode struct {
+	Name   string    `json:"name"`
+	Data   []byte    `json:"data,omitempty"`
+	State  NodeState `json:"state,omitempty"` // State is the NodeState of the node, 0 for active nodes.
+	Tokens [][]byte  `json:"tokens"`
+}
+
+// Snapshot captures the nodes, their states, tokens, hash configuration and key extractor name of the ring.
+// Nodes marked down aren't captured, the marks are transient.
+// encode is optional, it's only needed when nodes carry more than their String() representation.
+// The ring must use a registered hash function (see NewWithHashName) and HashKeys implementing
+// encoding.BinaryMarshaler, like Int64PairHashKey.
+func (h *HashRing) Snapshot(encode NodeEncoder) (*Snapshot, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.hashName == "" {
+		return nil, errors.New("hashring: ring hash function has no name, create it with NewWithHashName")
+	}
+	if h.keyExtractor != nil && h.keyExtractorName == "" {
+		return nil, errors.New("hashring: ring key extractor has no name, set it with a name in WithKeyExtractor")
+	}
+
+	snapshot := &Snapshot{
+		Version:      SnapshotVersion,
+		Hash:         h.hashName,
+		KeyExtractor: h.keyExtractorName,
+		VirtualNodes: h.virtualNodes,
+		Epoch:        h.epoch,
+		Nodes:        make([]SnapshotNode, 0, len(h.nodes)),
+	}
+	for _, node := range h.nodes {
+		snapshotNode := SnapshotNode{Name: node.String(), State: h.getNodeState(node)}
+		if encode != nil {
+			data, err := encode(node)
+			if err != nil {
+				return nil, fmt.Errorf("hashring: encoding node %s: %w", node, err)
+			}
+			snapshotNode.Data = data
+		}
+
+		tokens, err := nodeTokens(h.hashFunc, node, h.virtualNodes)
+		if err != nil {
+			return nil, err
+		}
+		snapshotNode.Tokens = tokens
+		snapshot.Nodes = append(snapshot.Nodes, snapshotNode)
+	}
+	return snapshot, nil
+}
+
+// nodeTokens returns the encoded tokens of node on a ring using hashFunc and virtualNodes tokens per node.
+func nodeTokens(hashFunc HashFunc, node Node, virtualNodes int) ([][]byte, error) {
+	tokens := make([][]byte, 0, virtualNodes)
+	for i := 0; i < virtualNodes; i++ {
+		key := hashFunc([]byte(virtualNodeKey(node, i)))
+		marshaler, ok := key.(encoding.BinaryMarshaler)
+		if !ok {
+			return nil, fmt.Errorf("hashring: %T doesn't implement encoding.BinaryMarshaler", key)
+		}
+		token, err := marshaler.MarshalBinary()
+		if err != nil {
+			return nil, fmt.Errorf("hashring: encoding token of node %s: %w", node, err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// Restore creates a HashRing from a Snapshot. decode recreates the nodes,
+// it's called with the name and data of every SnapshotNode.
+// The tokens of the restored ring are compared to the recorded ones and ErrSnapshotMismatch
+// is returned if they differ, for instance when a hash function got registered under another name.
+// ErrSnapshotMismatch is also returned if the key extractor of the snapshot isn't registered,
+// the restored ring wouldn't route keys the same way without it.
+func Restore(snapshot *Snapshot, decode NodeDecoder) (*HashRing, error) {
+	if snapshot.Version != SnapshotVersion {
+		return nil, fmt.Errorf("hashring: unsupported snapshot version %d", snapshot.Version)
+	}
+	if snapshot.VirtualNodes < 1 {
+		return nil, fmt.Errorf("hashring: invalid number of virtual nodes %d", snapshot.VirtualNodes)
+	}
+	hashFunc, ok := LookupHash(snapshot.Hash)
+	if !ok {
+		return nil, fmt.Errorf("hashring: hash function %q is not registered", snapshot.Hash)
+	}
+	var extractor KeyExtractor
+	if snapshot.KeyExtractor != "" {
+		if extractor, ok = LookupKeyExtractor(snapshot.KeyExtractor); !ok {
+			return nil, fmt.Errorf("%w: key extractor %q is not registered", ErrSnapshotMismatch, snapshot.KeyExtractor)
+		}
+	}
+
+	nodes := make([]Node, 0, len(snapshot.Nodes))
+	for _, snapshotNode := range snapshot.Nodes {
+		node, err := decode(snapshotNode.Name, snapshotNode.Data)
+		if err != nil {
+			return nil, fmt.Errorf("hashring: decoding node %s: %w", snapshotNode.Name, err)
+		}
+		if node.String() != snapshotNode.Name {
+			return nil, fmt.Errorf("%w: node %s decoded as %s", ErrSnapshotMismatch, snapshotNode.Name, node)
+		}
+
+		if len(snapshotNode.Tokens) != snapshot.VirtualNodes {
+			return nil, fmt.Errorf("%w: node %s has %d tokens for %d virtual nodes",
+				ErrSnapshotMismatch, snapshotNode.Name, len(snapshotNode.Tokens), snapshot.VirtualNodes)
+		}
+		tokens, err := nodeTokens(hashFunc, node, snapshot.VirtualNodes)
+		if err != nil {
+			return nil, err
+		}
+		if !equalTokens(tokens, snapshotNode.Tokens) {
+			return nil, fmt.Errorf("%w: tokens of node %s differ", ErrSnapshotMismatch, snapshotNode.Name)
+		}
+		if snapshotNode.State < NodeActive || snapshotNode.State > NodeLeaving {
+			return nil, fmt.Errorf("hashring: node %s has unknown state %d", snapshotNode.Name, int(snapshotNode.State))
+		}
+		nodes = append(nodes, node)
+	}
+
+	ring := newHashRing(nodes, hashFunc, snapshot.Hash, snapshot.VirtualNodes)
+	if extractor != nil {
+		ring.keyExtractor = extractor
+		ring.keyExtractorName = snapshot.KeyExtractor
+	}
+	if snapshot.Epoch > 0 {
+		ring.epoch = snapshot.Epoch
+	}
+	for _, snapshotNode := range snapshot.Nodes {
+		if snapshotNode.State != NodeActive {
+			if ring.states == nil {
+				ring.states = make(map[string]NodeState)
+			}
+			ring.states[snapshotNode.Name] = snapshotNode.State
+		}
+	}
+	return ring, nil
+}
+
+func equalTokens(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary encodes the snapshot in a compact versioned binary format.
+func (s *Snapshot) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(snapshotMagic)
+	writeUvarint(&buf, uint64(s.Version))
+	writeBytes(&buf, []byte(s.Hash))
+	writeBytes(&buf, []byte(s.KeyExtractor))
+	writeUvarint(&buf, uint64(s.VirtualNodes))
+	writeUvarint(&buf, s.Epoch)
+	writeUvarint(&buf, uint64(len(s.Nodes)))
+	for _, node := range s.Nodes {
+		writeBytes(&buf, []byte(node.Name))
+		writeBytes(&buf, node.Data)
+		writeUvarint(&buf, uint64(node.State))
+		writeUvarint(&buf, uint64(len(node.Tokens)))
+		for _, token := range node.Tokens {
+			writeBytes(&buf, token)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a snapshot written by MarshalBinary.
+func (s *Snapshot) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, snapshotMagic) {
+		return errors.New("hashring: not a binary snapshot")
+	}
+	r := bytes.NewReader(data[len(snapshotMagic):])
+
+	version, err := binary.ReadUvarint(r)
+	if err != nil {
+		return snapshotDecodingError(err)
+	}
+	if version != SnapshotVersion {
+		return fmt.Errorf("hashring: unsupported snapshot version %d", version)
+	}
+
+	decoded := Snapshot{Version: int(version)}
+	hash, err := readBytes(r)
+	if err != nil {
+		return snapshotDecodingError(err)
+	}
+	decoded.Hash = string(hash)
+	keyExtractor, err := readBytes(r)
+	if err != nil {
+		return snapshotDecodingError(err)
+	}
+	decoded.KeyExtractor = string(keyExtractor)
+	virtualNodes, err := binary.ReadUvarint(r)
+	if err != nil {
+		return snapshotDecodingError(err)
+	}
+	decoded.VirtualNodes = int(virtualNodes)
+	if decoded.Epoch, err = binary.ReadUvarint(r); err != nil {
+		return snapshotDecodingError(err)
+	}
+
+	count, err := readLength(r)
+	if err != nil {
+		return snapshotDecodingError(err)
+	}
+	decoded.Nodes = make([]SnapshotNode, 0, count)
+	for i := 0; i < count; i++ {
+		var node SnapshotNode
+		name, err := readBytes(r)
+		if err != nil {
+			return snapshotDecodingError(err)
+		}
+		node.Name = string(name)
+		if node.Data, err = readBytes(r); err != nil {
+			return snapshotDecodingError(err)
+		}
+		if len(node.Data) == 0 {
+			node.Data = nil
+		}
+		state, err := binary.ReadUvarint(r)
+		if err != nil {
+			return snapshotDecodingError(err)
+		}
+		if state > uint64(NodeLeaving) {
+			return fmt.Errorf("hashring: decoding snapshot: node %s has unknown state %d", node.Name, state)
+		}
+		node.State = NodeState(state)
+
+		tokens, err := readLength(r)
+		if err != nil {
+			return snapshotDecodingError(err)
+		}
+		node.Tokens = make([][]byte, 0, tokens)
+		for j := 0; j < tokens; j++ {
+			token, err := readBytes(r)
+			if err != nil {
+				return snapshotDecodingError(err)
+			}
+			node.Tokens = append(node.Tokens, token)
+		}
+		decoded.Nodes = append(decoded.Nodes, node)
+	}
+	if r.Len() > 0 {
+		return errors.New("hashring: decoding snapshot: trailing data")
+	}
+
+	*s = decoded
+	return nil
+}
+
+func snapshotDecodingError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("hashring: decoding snapshot: %w", err)
+}
+
+func writeUvarint(buf *bytes.Buffer, value uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], value)
+	buf.Write(scratch[:n])
+}
+
+func writeBytes(buf *bytes.Buffer, data []byte) {
+	writeUvarint(buf, uint64(len(data)))
+	buf.Write(data)
+}
+
+// readLength reads a length and makes sure it isn't larger than what's left to read,
+// so corrupted input can't trigger huge allocations.
+func readLength(r *bytes.Reader) (int, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, err
+	}
+	if length > uint64(r.Len()) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int(length), nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	length, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
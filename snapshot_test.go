@@ -0,0 +1,275 @@
+package hashring
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type weightedNode struct {
+	name   string
+	weight int
+}
+
+func (n weightedNode) String() string {
+	return n.name
+}
+
+func encodeWeightedNode(node Node) ([]byte, error) {
+	return []byte(strconv.Itoa(node.(weightedNode).weight)), nil
+}
+
+func decodeWeightedNode(name string, data []byte) (Node, error) {
+	weight, err := strconv.Atoi(string(data))
+	return weightedNode{name: name, weight: weight}, err
+}
+
+func decodeMyNode(name string, _ []byte) (Node, error) {
+	return myNode(name), nil
+}
+
+func assertSameLookups(t *testing.T, expected, actual *HashRing) {
+	for i := 0; i < 200; i++ {
+		key := fmt.Sprintf("key%d", i)
+		expectedNodes, _ := expected.GetNodesForReplicas(key, 2)
+		actualNodes, _ := actual.GetNodesForReplicas(key, 2)
+		if !assert.Equal(t, expectedNodes, actualNodes, key) {
+			return
+		}
+	}
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	ring, err := NewWithHashName([]Node{weightedNode{"a", 1}, weightedNode{"b", 2}, weightedNode{"c", 3}}, "sha256")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	snapshot, err := ring.Snapshot(encodeWeightedNode)
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, err := json.Marshal(snapshot)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var decoded Snapshot
+	if !assert.NoError(t, json.Unmarshal(data, &decoded)) {
+		return
+	}
+	assert.Equal(t, snapshot, &decoded)
+
+	restored, err := Restore(&decoded, decodeWeightedNode)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "sha256", restored.HashName())
+		assertSameLookups(t, ring, restored)
+
+		node, _ := restored.GetNode("test")
+		assert.Equal(t, 3, node.(weightedNode).weight)
+	}
+}
+
+func TestSnapshotBinary(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c", "d"}))
+	snapshot, err := ring.Snapshot(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "md5", snapshot.Hash)
+
+	data, err := snapshot.MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	var decoded Snapshot
+	if !assert.NoError(t, decoded.UnmarshalBinary(data)) {
+		return
+	}
+	assert.Equal(t, snapshot, &decoded)
+
+	restored, err := Restore(&decoded, decodeMyNode)
+	if assert.NoError(t, err) {
+		assertSameLookups(t, ring, restored)
+	}
+
+	for i := 0; i < len(data); i++ {
+		assert.Error(t, decoded.UnmarshalBinary(data[:i]), "truncated at %d", i)
+	}
+	assert.Error(t, decoded.UnmarshalBinary(append(data, 0)))
+}
+
+func TestSnapshotEpoch(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b"})).AddNode(myNode("c"))
+	snapshot, _ := ring.Snapshot(nil)
+
+	restored, err := Restore(snapshot, decodeMyNode)
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(2), restored.Epoch())
+	}
+
+	data, _ := snapshot.MarshalBinary()
+	var decoded Snapshot
+	if assert.NoError(t, decoded.UnmarshalBinary(data)) {
+		assert.Equal(t, uint64(2), decoded.Epoch)
+	}
+}
+
+func TestSnapshotNodeStates(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c", "d"})).
+		SetNodeState(myNode("b"), NodeDraining).
+		SetNodeState(myNode("d"), NodeJoining)
+	snapshot, err := ring.Snapshot(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	data, _ := snapshot.MarshalBinary()
+	var fromBinary Snapshot
+	assert.NoError(t, fromBinary.UnmarshalBinary(data))
+	data, _ = json.Marshal(snapshot)
+	var fromJSON Snapshot
+	assert.NoError(t, json.Unmarshal(data, &fromJSON))
+
+	for _, decoded := range []*Snapshot{&fromBinary, &fromJSON} {
+		restored, err := Restore(decoded, decodeMyNode)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, NodeDraining, restored.NodeState(myNode("b")))
+		assert.Equal(t, NodeJoining, restored.NodeState(myNode("d")))
+		assert.Equal(t, ring.Fingerprint(), restored.Fingerprint())
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("key%d", i)
+			for _, purpose := range []Purpose{ForRead, ForWrite} {
+				expected, _ := ring.GetNodesForReplicasFor(purpose, key, 2)
+				actual, _ := restored.GetNodesForReplicasFor(purpose, key, 2)
+				assert.Equal(t, expected, actual, key)
+			}
+		}
+	}
+
+	snapshot.Nodes[0].State = NodeLeaving + 1
+	_, err = Restore(snapshot, decodeMyNode)
+	assert.Error(t, err)
+}
+
+func TestSnapshotVirtualNodes(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c"})).WithVirtualNodes(8)
+	snapshot, err := ring.Snapshot(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 8, snapshot.VirtualNodes)
+	assert.Len(t, snapshot.Nodes[0].Tokens, 8)
+
+	data, _ := snapshot.MarshalBinary()
+	var decoded Snapshot
+	if !assert.NoError(t, decoded.UnmarshalBinary(data)) {
+		return
+	}
+	restored, err := Restore(&decoded, decodeMyNode)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 8, restored.VirtualNodes())
+		assert.Equal(t, ring.Fingerprint(), restored.Fingerprint())
+		assertSameLookups(t, ring, restored)
+	}
+
+	decoded.VirtualNodes = 4
+	_, err = Restore(&decoded, decodeMyNode)
+	assert.True(t, errors.Is(err, ErrSnapshotMismatch), err)
+
+	decoded.VirtualNodes = 0
+	_, err = Restore(&decoded, decodeMyNode)
+	assert.EqualError(t, err, "hashring: invalid number of virtual nodes 0")
+}
+
+func TestSnapshotKeyExtractor(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c", "d"})).AddNode(myNode("e")).
+		WithKeyExtractor("hashtag", HashTagExtractor())
+	snapshot, err := ring.Snapshot(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "hashtag", snapshot.KeyExtractor)
+
+	data, _ := json.Marshal(snapshot)
+	var decoded Snapshot
+	if !assert.NoError(t, json.Unmarshal(data, &decoded)) {
+		return
+	}
+	restored, err := Restore(&decoded, decodeMyNode)
+	if assert.NoError(t, err) {
+		assert.Equal(t, ring.Epoch(), restored.Epoch())
+		assert.Equal(t, ring.Fingerprint(), restored.Fingerprint())
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("{user:%d}:profile", i)
+			expected, _ := ring.GetNode(key)
+			node, _ := restored.GetNode(key)
+			assert.Equal(t, expected, node, key)
+		}
+	}
+
+	binary, _ := snapshot.MarshalBinary()
+	if assert.NoError(t, decoded.UnmarshalBinary(binary)) {
+		assert.Equal(t, "hashtag", decoded.KeyExtractor)
+	}
+
+	decoded.KeyExtractor = "unregistered"
+	_, err = Restore(&decoded, decodeMyNode)
+	assert.True(t, errors.Is(err, ErrSnapshotMismatch), err)
+
+	RegisterKeyExtractor("test-prefix", PrefixExtractor(":"))
+	prefixed := ring.WithKeyExtractor("test-prefix", PrefixExtractor(":"))
+	snapshot, _ = prefixed.Snapshot(nil)
+	restored, err = Restore(snapshot, decodeMyNode)
+	if assert.NoError(t, err) {
+		assert.Equal(t, prefixed.Fingerprint(), restored.Fingerprint())
+	}
+
+	_, err = ring.WithKeyExtractor("", PrefixExtractor(":")).Snapshot(nil)
+	assert.Error(t, err, "unnamed extractors can't be restored")
+}
+
+func TestSnapshotMismatch(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b"}))
+	snapshot, err := ring.Snapshot(nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// another hash function registered under the recorded name
+	hashFunc, _ := NewHash(sha256.New).FirstBytes(16).Use(NewInt64PairHashKey)
+	RegisterHash("test-mismatch", hashFunc)
+	snapshot.Hash = "test-mismatch"
+	_, err = Restore(snapshot, decodeMyNode)
+	assert.True(t, errors.Is(err, ErrSnapshotMismatch), err)
+
+	snapshot.Hash = "md5"
+	_, err = Restore(snapshot, func(name string, _ []byte) (Node, error) {
+		return myNode(name + "x"), nil
+	})
+	assert.True(t, errors.Is(err, ErrSnapshotMismatch), err)
+
+	snapshot.Version = SnapshotVersion + 1
+	_, err = Restore(snapshot, decodeMyNode)
+	assert.EqualError(t, err, fmt.Sprintf("hashring: unsupported snapshot version %d", SnapshotVersion+1))
+
+	snapshot.Version = SnapshotVersion
+	snapshot.Hash = "unknown"
+	_, err = Restore(snapshot, decodeMyNode)
+	assert.EqualError(t, err, `hashring: hash function "unknown" is not registered`)
+}
+
+func TestSnapshotUnnamedHash(t *testing.T) {
+	hashFunc, _ := NewHash(sha256.New).FirstBytes(16).Use(NewInt64PairHashKey)
+	ring := NewWithHash(stringSliceToNodeSlice([]string{"a"}), hashFunc)
+
+	_, err := ring.Snapshot(nil)
+	assert.Error(t, err)
+}
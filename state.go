@@ -0,0 +1,153 @@
+package hashring
+
+import "fmt"
+
+// NodeState is the lifecycle state of a node in the ring.
+// Node states don't move tokens: keys keep their position on the ring,
+// lookups made with GetNodeFor and GetNodesForReplicasFor just skip the nodes
+// which can't serve the requested Purpose.
+type NodeState int
+
+const (
+	// NodeActive nodes serve reads and writes. It's the state of every node added to a ring.
+	NodeActive NodeState = iota
+	// NodeJoining nodes receive writes, so that they can be warmed up, but don't serve reads yet.
+	NodeJoining
+	// NodeDraining nodes don't receive writes and are only used as fallback replicas for reads,
+	// until their data is migrated.
+	NodeDraining
+	// NodeLeaving nodes are neither written to nor read from, they are about to be removed.
+	NodeLeaving
+)
+
+func (s NodeState) String() string {
+	switch s {
+	case NodeActive:
+		return "active"
+	case NodeJoining:
+		return "joining"
+	case NodeDraining:
+		return "draining"
+	case NodeLeaving:
+		return "leaving"
+	default:
+		return fmt.Sprintf("NodeState(%d)", int(s))
+	}
+}
+
+// Purpose tells GetNodeFor and GetNodesForReplicasFor what the nodes are needed for.
+type Purpose int
+
+const (
+	// ForRead picks active nodes, with draining nodes as fallbacks.
+	ForRead Purpose = iota
+	// ForWrite picks active and joining nodes.
+	ForWrite
+)
+
+func (p Purpose) String() string {
+	switch p {
+	case ForRead:
+		return "read"
+	case ForWrite:
+		return "write"
+	default:
+		return fmt.Sprintf("Purpose(%d)", int(p))
+	}
+}
+
+// serves reports whether a node in the given state can be picked for purpose, leaving fallbacks aside.
+func (s NodeState) serves(purpose Purpose) bool {
+	switch s {
+	case NodeActive:
+		return true
+	case NodeJoining:
+		return purpose == ForWrite
+	default:
+		return false
+	}
+}
+
+// SetNodeState generates a new hashring where node is in the given state.
+// Tokens don't change, so keys only move for lookups using a Purpose.
+// h is returned as is if node isn't part of the ring or is already in that state.
+func (h *HashRing) SetNodeState(node Node, state NodeState) *HashRing {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.hasNode(node) || h.getNodeState(node) == state {
+		return h
+	}
+
+	nodes := make([]Node, len(h.nodes))
+	copy(nodes, h.nodes)
+	hashRing := h.derive(nodes)
+	if state == NodeActive {
+		delete(hashRing.states, node.String())
+	} else {
+		if hashRing.states == nil {
+			hashRing.states = make(map[string]NodeState)
+		}
+		hashRing.states[node.String()] = state
+	}
+	return hashRing
+}
+
+// NodeState returns the state of node, NodeActive for nodes which aren't part of the ring.
+func (h *HashRing) NodeState(node Node) NodeState {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.getNodeState(node)
+}
+
+// getNodeState requires RLock(), make sure the caller is doing it
+func (h *HashRing) getNodeState(node Node) NodeState {
+	return h.states[node.String()]
+}
+
+// GetNodeFor returns the first node clockwise from stringKey which can serve purpose.
+func (h *HashRing) GetNodeFor(purpose Purpose, stringKey string) (node Node, ok bool) {
+	nodes, ok := h.GetNodesForReplicasFor(purpose, stringKey, 1)
+	if !ok {
+		return nil, false
+	}
+	return nodes[0], true
+}
+
+// GetNodesForReplicasFor is like GetNodesForReplicas, but honors node states.
+// It returns the first numberOfReplicas nodes clockwise from stringKey which can serve purpose and aren't down.
+// For reads, the draining nodes met along the way are appended after them as fallbacks.
+// ok is false if less than numberOfReplicas nodes can serve purpose, nodes then holds the ones found,
+// like GetNodesForReplicas does when nodes are down.
+func (h *HashRing) GetNodesForReplicasFor(purpose Purpose, stringKey string, numberOfReplicas int) (nodes []Node, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	pos, ok := h.getNodePos(stringKey)
+	if !ok || numberOfReplicas < 1 {
+		return nil, false
+	}
+
+	nodes = make([]Node, 0, numberOfReplicas)
+	fallbacks := make([]Node, 0)
+	seen := make(map[Node]bool, numberOfReplicas)
+	for i := pos; i < pos+len(h.sortedKeys) && len(nodes) < numberOfReplicas; i++ {
+		node := h.nodeHashMap[h.sortedKeys[i%len(h.sortedKeys)]]
+		if seen[node] || h.down[node.String()] {
+			continue
+		}
+		seen[node] = true
+
+		state := h.getNodeState(node)
+		switch {
+		case state.serves(purpose):
+			nodes = append(nodes, node)
+		case state == NodeDraining && purpose == ForRead:
+			fallbacks = append(fallbacks, node)
+		}
+	}
+
+	ok = len(nodes) == numberOfReplicas
+	return append(nodes, fallbacks...), ok
+}
@@ -0,0 +1,82 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeStatesAllActive(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c", "d"}))
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		expected, _ := ring.GetNodesForReplicas(key, 2)
+		for _, purpose := range []Purpose{ForRead, ForWrite} {
+			nodes, ok := ring.GetNodesForReplicasFor(purpose, key, 2)
+			assert.True(t, ok)
+			assert.Equal(t, expected, nodes, "%s %s", purpose, key)
+		}
+	}
+}
+
+func TestNodeStates(t *testing.T) {
+	// "test" walks d, a, c, b
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c", "d"}))
+
+	joining := ring.SetNodeState(myNode("d"), NodeJoining)
+	assert.Equal(t, NodeJoining, joining.NodeState(myNode("d")))
+	assert.Equal(t, ring.Epoch()+1, joining.Epoch())
+	assertPurposeNodes(t, joining, ForRead, "a", "c")
+	assertPurposeNodes(t, joining, ForWrite, "d", "a")
+
+	draining := ring.SetNodeState(myNode("d"), NodeDraining)
+	assertPurposeNodes(t, draining, ForRead, "a", "c", "d")
+	assertPurposeNodes(t, draining, ForWrite, "a", "c")
+
+	leaving := draining.SetNodeState(myNode("a"), NodeLeaving)
+	assertPurposeNodes(t, leaving, ForRead, "c", "b", "d")
+	assertPurposeNodes(t, leaving, ForWrite, "c", "b")
+
+	node, ok := leaving.GetNodeFor(ForRead, "test")
+	assert.True(t, ok)
+	assert.Equal(t, myNode("c"), node)
+
+	active := leaving.SetNodeState(myNode("a"), NodeActive).SetNodeState(myNode("d"), NodeActive)
+	assert.Equal(t, ring.Fingerprint(), active.Fingerprint())
+	assertPurposeNodes(t, active, ForRead, "d", "a")
+}
+
+func assertPurposeNodes(t *testing.T, ring *HashRing, purpose Purpose, expected ...string) {
+	nodes, ok := ring.GetNodesForReplicasFor(purpose, "test", 2)
+	assert.True(t, ok)
+	assert.Equal(t, stringSliceToNodeSlice(expected), nodes, purpose.String())
+}
+
+func TestNodeStatesNotEnoughNodes(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b"})).SetNodeState(myNode("a"), NodeJoining)
+
+	nodes, ok := ring.GetNodesForReplicasFor(ForRead, "test", 2)
+	assert.False(t, ok)
+	assert.Equal(t, []Node{myNode("b")}, nodes, "the nodes found are returned")
+	_, ok = ring.GetNodesForReplicasFor(ForWrite, "test", 2)
+	assert.True(t, ok)
+
+	_, ok = ring.SetNodeState(myNode("b"), NodeDraining).GetNodeFor(ForRead, "test")
+	assert.False(t, ok)
+}
+
+func TestNodeStatesCarriedOver(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b"})).SetNodeState(myNode("a"), NodeDraining)
+
+	assert.Same(t, ring, ring.SetNodeState(myNode("a"), NodeDraining))
+	assert.Same(t, ring, ring.SetNodeState(myNode("x"), NodeDraining))
+
+	assert.Equal(t, NodeDraining, ring.AddNode(myNode("c")).NodeState(myNode("a")))
+	assert.Equal(t, NodeActive, ring.RemoveNode(myNode("a")).AddNode(myNode("a")).NodeState(myNode("a")))
+
+	diff := CompareSummaries(ring.Summary(), ring.SetNodeState(myNode("a"), NodeActive).Summary())
+	assert.Equal(t, []string{"a"}, diff.StateChanged)
+	assert.NotEqual(t, ring.Fingerprint(), ring.SetNodeState(myNode("a"), NodeActive).Fingerprint())
+}
@@ -0,0 +1,100 @@
+package hashring
+
+import "math"
+
+// NodeOwnership is the portion of the keyspace owned by a single node.
+type NodeOwnership struct {
+	Node    Node
+	Primary float64 // Primary is the fraction of the keyspace the node is the first choice for.
+	Replica float64 // Replica is the fraction of the keyspace the node is one of the replicas for, primary included.
+}
+
+// OwnershipSummary describes how evenly ownership is spread over the nodes of a ring.
+type OwnershipSummary struct {
+	Min          float64
+	Max          float64
+	Mean         float64
+	StdDev       float64
+	MaxMeanRatio float64 // MaxMeanRatio is Max / Mean, 1 for a perfectly balanced ring.
+}
+
+// Ownership is the distribution of the keyspace over the nodes of a ring.
+type Ownership struct {
+	Replicas int
+	Nodes    []NodeOwnership // Nodes are sorted by their String() representation.
+	Primary  OwnershipSummary
+	Replica  OwnershipSummary
+}
+
+// Ownership computes, per node, the fraction of the hash space it owns as primary and as one of
+// numberOfReplicas replicas, as returned by GetNodesForReplicas.
+// Fractions are only available for HashKeys implementing PositionedHashKey, they are 0 otherwise.
+func (h *HashRing) Ownership(numberOfReplicas int) Ownership {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if numberOfReplicas < 1 {
+		numberOfReplicas = 1
+	}
+
+	uniqueNodes := h.getUniqueNodes()
+	nodes := make([]NodeOwnership, len(uniqueNodes))
+	index := make(map[string]int, len(uniqueNodes))
+	for i, node := range uniqueNodes {
+		index[node.String()] = i
+		nodes[i].Node = node
+	}
+
+	keys := h.uniqueKeys()
+	for i, end := range keys {
+		start := keys[(i+len(keys)-1)%len(keys)]
+		fraction := Range{Start: start, End: end}.Fraction()
+		for j, node := range h.getNodesForHashKey(start, numberOfReplicas) {
+			ownership := &nodes[index[node.String()]]
+			if j == 0 {
+				ownership.Primary += fraction
+			}
+			ownership.Replica += fraction
+		}
+	}
+
+	primary := make([]float64, len(nodes))
+	replica := make([]float64, len(nodes))
+	for i, ownership := range nodes {
+		primary[i] = ownership.Primary
+		replica[i] = ownership.Replica
+	}
+
+	return Ownership{
+		Replicas: numberOfReplicas,
+		Nodes:    nodes,
+		Primary:  summarize(primary),
+		Replica:  summarize(replica),
+	}
+}
+
+func summarize(values []float64) OwnershipSummary {
+	if len(values) == 0 {
+		return OwnershipSummary{}
+	}
+
+	summary := OwnershipSummary{Min: values[0], Max: values[0]}
+	sum := 0.0
+	for _, value := range values {
+		summary.Min = math.Min(summary.Min, value)
+		summary.Max = math.Max(summary.Max, value)
+		sum += value
+	}
+	summary.Mean = sum / float64(len(values))
+
+	variance := 0.0
+	for _, value := range values {
+		variance += (value - summary.Mean) * (value - summary.Mean)
+	}
+	summary.StdDev = math.Sqrt(variance / float64(len(values)))
+
+	if summary.Mean > 0 {
+		summary.MaxMeanRatio = summary.Max / summary.Mean
+	}
+	return summary
+}
@@ -0,0 +1,60 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnership(t *testing.T) {
+	ring := New(stringSliceToNodeSlice([]string{"a", "b", "c", "d"}))
+	ownership := ring.Ownership(2)
+
+	assert.Equal(t, 2, ownership.Replicas)
+	if !assert.Len(t, ownership.Nodes, 4) {
+		return
+	}
+
+	primary, replica := 0.0, 0.0
+	for _, node := range ownership.Nodes {
+		assert.LessOrEqual(t, node.Primary, node.Replica)
+		primary += node.Primary
+		replica += node.Replica
+	}
+	assert.InDelta(t, 1.0, primary, 1e-9)
+	assert.InDelta(t, 2.0, replica, 1e-9)
+
+	assert.InDelta(t, 0.25, ownership.Primary.Mean, 1e-9)
+	assert.InDelta(t, 0.5, ownership.Replica.Mean, 1e-9)
+	assert.LessOrEqual(t, ownership.Primary.Min, ownership.Primary.Mean)
+	assert.GreaterOrEqual(t, ownership.Primary.Max, ownership.Primary.Mean)
+	assert.InDelta(t, ownership.Primary.Max/0.25, ownership.Primary.MaxMeanRatio, 1e-9)
+}
+
+func TestOwnershipMatchesLookups(t *testing.T) {
+	ring := New(generateNodes(5))
+	ownership := ring.Ownership(1)
+
+	const samples = 20000
+	counts := map[string]int{}
+	for i := 0; i < samples; i++ {
+		node, _ := ring.GetNode(fmt.Sprintf("key%d", i))
+		counts[node.String()]++
+	}
+	for _, node := range ownership.Nodes {
+		assert.InDelta(t, node.Primary, float64(counts[node.Node.String()])/samples, 0.02, node.Node.String())
+	}
+}
+
+func TestOwnershipSingleAndEmpty(t *testing.T) {
+	ownership := New(stringSliceToNodeSlice([]string{"a", "a"})).Ownership(3)
+	if assert.Len(t, ownership.Nodes, 1) {
+		assert.Equal(t, 1.0, ownership.Nodes[0].Primary)
+		assert.Equal(t, 1.0, ownership.Nodes[0].Replica)
+	}
+	assert.Equal(t, 1.0, ownership.Primary.MaxMeanRatio)
+	assert.Equal(t, 0.0, ownership.Primary.StdDev)
+
+	assert.Empty(t, New(stringSliceToNodeSlice([]string{})).Ownership(1).Nodes)
+}
@@ -0,0 +1,71 @@
+package hashring
+
+// Transition routes keys while a membership change is being migrated from an old ring to a new one.
+// Writes go to the owner in the new ring, reads can fall back to the owner in the old ring
+// until the keys that moved have been migrated.
+type Transition struct {
+	old *HashRing
+	new *HashRing
+}
+
+// TransitionLookup is the result of a lookup during a Transition.
+type TransitionLookup struct {
+	Primary  Node // Primary owns the key in the new ring, reads and writes go there first.
+	Fallback Node // Fallback owns the key in the old ring, nil if the old ring is empty.
+	Moved    bool // Moved is true when Primary and Fallback differ, reads missing on Primary should try Fallback.
+}
+
+// NewTransition creates a Transition from old to new.
+// Both rings must be created with the same HashFunc.
+func NewTransition(old, new *HashRing) *Transition {
+	return &Transition{old: old, new: new}
+}
+
+// Old returns the ring the transition starts from.
+func (t *Transition) Old() *HashRing {
+	return t.old
+}
+
+// New returns the ring the transition goes to.
+func (t *Transition) New() *HashRing {
+	return t.new
+}
+
+// GetNode returns where stringKey lives during the transition.
+// ok is false if the new ring is empty.
+func (t *Transition) GetNode(stringKey string) (lookup TransitionLookup, ok bool) {
+	primary, ok := t.new.GetNode(stringKey)
+	if !ok {
+		return TransitionLookup{}, false
+	}
+
+	lookup.Primary = primary
+	if fallback, ok := t.old.GetNode(stringKey); ok {
+		lookup.Fallback = fallback
+		lookup.Moved = !sameNode(primary, fallback)
+	}
+	return lookup, true
+}
+
+// GetNodesForReplicas returns the replicas of stringKey in the new ring, followed by the replicas
+// of the old ring which aren't part of them. Writes should go to the first numberOfReplicas nodes,
+// reads can try the remaining ones when the data hasn't been migrated yet.
+// ok is false if the new ring doesn't have enough nodes.
+func (t *Transition) GetNodesForReplicas(stringKey string, numberOfReplicas int) (nodes []Node, ok bool) {
+	nodes, ok = t.new.GetNodesForReplicas(stringKey, numberOfReplicas)
+	if !ok {
+		return nil, false
+	}
+
+	// the old ring may have less nodes than needed, take whatever it has
+	old, ok := t.old.GetNodesForReplicas(stringKey, numberOfReplicas)
+	if !ok {
+		old, _ = t.old.GetNodesForReplicas(stringKey, len(t.old.Nodes()))
+	}
+	for _, node := range old {
+		if !containsNode(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, true
+}
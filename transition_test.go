@@ -0,0 +1,58 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransition(t *testing.T) {
+	old := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+	new := old.AddNode(myNode("d"))
+	transition := NewTransition(old, new)
+
+	lookup, ok := transition.GetNode("test")
+	assert.True(t, ok)
+	assert.Equal(t, TransitionLookup{Primary: myNode("d"), Fallback: myNode("a"), Moved: true}, lookup)
+
+	lookup, ok = transition.GetNode("test1")
+	assert.True(t, ok)
+	assert.Equal(t, TransitionLookup{Primary: myNode("b"), Fallback: myNode("b"), Moved: false}, lookup)
+
+	changes := Diff(old, new)
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("key%d", i)
+		lookup, _ := transition.GetNode(key)
+		_, moved := findChange(changes, new.GenKey(key))
+		assert.Equal(t, moved, lookup.Moved, key)
+	}
+}
+
+func TestTransitionReplicas(t *testing.T) {
+	old := New(stringSliceToNodeSlice([]string{"a", "b", "c"}))
+	transition := NewTransition(old, old.AddNode(myNode("d")))
+
+	nodes, ok := transition.GetNodesForReplicas("test", 2)
+	assert.True(t, ok)
+	assert.Equal(t, stringSliceToNodeSlice([]string{"d", "a", "c"}), nodes)
+
+	_, ok = transition.GetNodesForReplicas("test", 5)
+	assert.False(t, ok)
+}
+
+func TestTransitionEmptyRings(t *testing.T) {
+	empty := New(stringSliceToNodeSlice([]string{}))
+	ring := New(stringSliceToNodeSlice([]string{"a"}))
+
+	lookup, ok := NewTransition(empty, ring).GetNode("test")
+	assert.True(t, ok)
+	assert.Equal(t, TransitionLookup{Primary: myNode("a")}, lookup)
+
+	nodes, ok := NewTransition(empty, ring).GetNodesForReplicas("test", 1)
+	assert.True(t, ok)
+	assert.Equal(t, stringSliceToNodeSlice([]string{"a"}), nodes)
+
+	_, ok = NewTransition(ring, empty).GetNode("test")
+	assert.False(t, ok)
+}